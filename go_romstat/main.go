@@ -48,6 +48,14 @@ func main() {
 		info, _ := json.MarshalIndent(pkgInfo, "", "  ")
 		fmt.Println(string(info))
 		return
+	} else if data.GetCmdParameters().IsUdpEcho() {
+		//responder of the udp probe, e.g. 'romstat udpecho :7777'
+		address := data.GetCmdParameters().GetUdpEchoAddress()
+		fmt.Println("udp echo listening on", address)
+		if err := utils.RunUdpEchoServer(address); err != nil {
+			fmt.Println("ERROR:", err.Error())
+		}
+		return
 	} else if data.GetCmdParameters().Ask != "" {
 		answer, err := stat.AskPipelineServer(data.GetCmdParameters().Ask)
 		if err != nil {
@@ -58,15 +66,20 @@ func main() {
 		return
 	}
 
+	if err := data.LoadConfig(data.GetCmdParameters().ConfFile); err != nil {
+		fmt.Println("ERROR:", err.Error())
+		return
+	}
 	utils.InitLogger()
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	mgmt := stat.InitStatByType([]string{"system", "display", "network", "ping"})
+	mgmt := stat.InitStatByType(data.GetCmdParameters().GetPlugins())
 	go mgmt.Start(1)
 	defer stat.UnloadPlugins()
 
 	go stat.NewPipelineServerListen()
 	<-c
+	mgmt.OutputSummary()
 }
@@ -7,6 +7,9 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	_ "net/http/pprof"
@@ -24,19 +27,97 @@ type CmdlineParameters struct {
 	TargetSurface string
 	LockSurface   bool
 	Ask           string
+	FrameTimeline bool
+	LayerInfo     bool
+	Plugins       string
+	ThreadTopN    int
+	Threads       string
+	ConfFile      string
 }
 
-func (t *CmdlineParameters) getPkgRunningPid() int32 {
+// splitList splits a comma separated parameter, the empty items are skipped
+func splitList(sz string) []string {
+	items := make([]string, 0)
+	for _, v := range strings.Split(sz, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// GetPkgPatterns returns the package names or globs given by '-p', separated by comma
+func (t *CmdlineParameters) GetPkgPatterns() []string {
+	return splitList(t.PkgName)
+}
+
+// MatchPackage checks whether the package is one of the monitored packages,
+// any package is matched if no package is given
+func (t *CmdlineParameters) MatchPackage(pkgName string) bool {
+	patterns := t.GetPkgPatterns()
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, pkgName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPlugins returns the names of the plugins to run
+func (t *CmdlineParameters) GetPlugins() []string {
+	return splitList(t.Plugins)
+}
+
+// GetThreadPatterns returns the thread name globs given by '-threads'
+func (t *CmdlineParameters) GetThreadPatterns() []string {
+	return splitList(t.Threads)
+}
+
+// foregroundPkgName is saved by the display plugin and read by all plugins
+var (
+	foregroundLock    sync.Mutex
+	foregroundPkgName string
+)
+
+// SetForegroundPkgName saves the monitored package which is measured in foreground
+func (t *CmdlineParameters) SetForegroundPkgName(pkgName string) {
+	foregroundLock.Lock()
+	defer foregroundLock.Unlock()
+	foregroundPkgName = pkgName
+}
+
+// IsPkgResolved checks whether the monitored package is known, it is false until one of the packages
+// given by globs has been in foreground, the per-app columns are empty until then
+func (t *CmdlineParameters) IsPkgResolved() bool {
+	return len(t.GetPkgPatterns()) == 0 || t.GetMonitorPkgName() != ""
+}
+
+// GetMonitorPkgName returns the package name of the target process:
+//   - the package given by '-p' if it is a single package name
+//   - the last monitored package measured in foreground if several packages or globs are given
+func (t *CmdlineParameters) GetMonitorPkgName() string {
+	patterns := t.GetPkgPatterns()
+	if len(patterns) == 0 {
+		return ""
+	}
+	if len(patterns) == 1 && !strings.ContainsAny(patterns[0], "*?[") {
+		return patterns[0]
+	}
+	foregroundLock.Lock()
+	defer foregroundLock.Unlock()
+	return foregroundPkgName
+}
+
+func (t *CmdlineParameters) getPkgRunningPid(monitorPkgName string) int32 {
 	allProcesses, err := process.Processes()
 	if err != nil {
 		return 0
 	}
 	for _, p := range allProcesses {
-		pkgName, err := p.Name()
-		if err != nil {
-			continue
-		}
-		if pkgName == t.PkgName {
+		if getProcessName(p) == monitorPkgName {
 			return p.Pid
 		}
 	}
@@ -44,40 +125,65 @@ func (t *CmdlineParameters) getPkgRunningPid() int32 {
 }
 
 var runningPid int32
+var runningPidPkgName string
 var runningPidLastUpdated time.Time
 
 func (t *CmdlineParameters) GetPid() int32 {
-	if t.PkgName == "" {
+	monitorPkgName := t.GetMonitorPkgName()
+	if monitorPkgName == "" {
 		return 0
 	}
-	if runningPid != 0 && time.Since(runningPidLastUpdated) < 10*time.Second {
+	if runningPid != 0 && runningPidPkgName == monitorPkgName && time.Since(runningPidLastUpdated) < 10*time.Second {
 		_, err := process.NewProcess(runningPid)
 		if err != nil {
-			runningPid = t.getPkgRunningPid()
+			runningPid = t.getPkgRunningPid(monitorPkgName)
 			runningPidLastUpdated = time.Now()
 			return runningPid
 		}
 		return runningPid
 	} else {
-		runningPid = t.getPkgRunningPid()
+		runningPid = t.getPkgRunningPid(monitorPkgName)
+		runningPidPkgName = monitorPkgName
 		runningPidLastUpdated = time.Now()
 		return runningPid
 	}
 }
 
+// IsUdpEcho checks whether the udpecho subcommand is given, 'romstat udpecho [address]'
+func (t *CmdlineParameters) IsUdpEcho() bool {
+	return len(flag.Args()) >= 1 && flag.Args()[0] == "udpecho"
+}
+
+// GetUdpEchoAddress returns the listening address of the udpecho subcommand, ':7777' by default
+func (t *CmdlineParameters) GetUdpEchoAddress() string {
+	if len(flag.Args()) >= 2 {
+		return flag.Args()[1]
+	}
+	return ":7777"
+}
+
 var cmdParameters CmdlineParameters
 
 func InitCmdParser() {
-	flag.StringVar(&cmdParameters.PkgName, "p", "", "application package name, default all system")
+	flag.StringVar(&cmdParameters.PkgName, "p", "", "application package names or globs separated by comma, default all system")
 	flag.BoolVar(&cmdParameters.IsDebug, "d", false, "is debug mode, default false")
 	flag.StringVar(&cmdParameters.TargetSurface, "ts", "", "specify target surface, default for auto")
 	flag.BoolVar(&cmdParameters.LockSurface, "lock", false, "lock collected package surface, cannot transfer to application")
+	flag.BoolVar(&cmdParameters.FrameTimeline, "ftl", false, "classify jank with android 12+ SurfaceFlinger FrameTimeline, default false")
+	flag.BoolVar(&cmdParameters.LayerInfo, "layer", false, "track buffer size, format, dataspace and composition of target surface, default false")
+	flag.StringVar(&cmdParameters.Plugins, "plugins", "system,display,network,ping", "plugins to run separated by comma: system,display,network,ping,cpu,thread,gpu,thermal,battery,memory,io,sched,psi,process,tcp,radio,video,audio,logcat")
+	flag.IntVar(&cmdParameters.ThreadTopN, "topn", 3, "count of the busiest threads reported by thread plugin")
+	flag.StringVar(&cmdParameters.Threads, "threads", "", "thread name globs always reported by thread plugin separated by comma, e.g. UnityMain,RenderThread")
+	flag.StringVar(&cmdParameters.ConfFile, "conf", "", "json config file path, e.g. network interfaces to count")
 	flag.StringVar(&cmdParameters.PemFile, "pem", "", "pem file path, ras pubkey file")
 	flag.BoolVar(&cmdParameters.IsVersion, "v", false, "print version information")
 	flag.BoolVar(&cmdParameters.IsPInfo, "pinfo", false, "print package information, default topmost package")
 	flag.BoolVar(&cmdParameters.IsListRunning, "running", false, "print all running package name")
 	flag.StringVar(&cmdParameters.Ask, "ask", "", "ask for master process from pipeline: current_pkg_surface")
 	flag.Parse()
+	if cmdParameters.ThreadTopN < 0 {
+		cmdParameters.ThreadTopN = 0
+	}
 	if cmdParameters.IsPInfo {
 		if len(flag.Args()) >= 1 {
 			cmdParameters.PkgName = flag.Args()[0]
@@ -0,0 +1,27 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestIsPkgResolved(t *testing.T) {
+	defer (&CmdlineParameters{}).SetForegroundPkgName("")
+	cases := []struct {
+		pkgName    string
+		foreground string
+		expect     bool
+	}{
+		{"", "", true},
+		{"com.haima.cloudgame", "", true},
+		{"com.haima.*", "", false},
+		{"com.haima.cloudgame,com.haima.launcher", "", false},
+		{"com.haima.*", "com.haima.cloudgame", true},
+	}
+	for _, v := range cases {
+		params := &CmdlineParameters{PkgName: v.pkgName}
+		params.SetForegroundPkgName(v.foreground)
+		if ret := params.IsPkgResolved(); ret != v.expect {
+			t.Errorf("ERROR: %s foreground=%s resolved=%v, expect %v", v.pkgName, v.foreground, ret, v.expect)
+		}
+	}
+}
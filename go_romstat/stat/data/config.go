@@ -0,0 +1,266 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+)
+
+// NetworkConfig selects the interfaces counted by the network plugin, the names are matched with path.Match
+type NetworkConfig struct {
+	Include      []string `json:"include"`       //interface globs to count, the platform default if empty
+	Exclude      []string `json:"exclude"`       //interface globs to skip, applied after include
+	PerInterface []string `json:"per_interface"` //interface names reported in their own columns
+}
+
+// Types of the latency probes
+const (
+	ProbeIcmp = "icmp" //round trip time of icmp echo
+	ProbeTcp  = "tcp"  //tcp connect time
+	ProbeHttp = "http" //http(s) time to first byte
+	ProbeUdp  = "udp"  //round trip time of the udp echo of 'romstat udpecho'
+)
+
+// maxIcmpProbeCount keeps the icmp interval at 200ms, the minimum of the ping command for non-root
+const maxIcmpProbeCount = 5
+
+// ProbeTarget is a latency probe target of the ping plugin
+type ProbeTarget struct {
+	Name  string `json:"name"`  //column prefix when several targets are configured, the host by default
+	Type  string `json:"type"`  //icmp by default
+	Host  string `json:"host"`  //domain or ip for icmp, host:port for tcp and udp, url for http
+	Count int    `json:"count"` //probes per second, 5 by default and 1 for http, at most 5 for icmp
+}
+
+// GetHostname returns the domain or ip address of the target
+func (t *ProbeTarget) GetHostname() string {
+	switch t.Type {
+	case ProbeTcp, ProbeUdp:
+		hostname, _, _ := net.SplitHostPort(t.Host)
+		return hostname
+	case ProbeHttp:
+		if u, err := url.Parse(t.Host); err == nil {
+			return u.Hostname()
+		}
+		return ""
+	}
+	return t.Host
+}
+
+func (t *ProbeTarget) validate() error {
+	if t.Type == "" {
+		t.Type = ProbeIcmp
+	}
+	switch t.Type {
+	case ProbeIcmp:
+	case ProbeTcp, ProbeUdp:
+		if _, _, err := net.SplitHostPort(t.Host); err != nil {
+			return fmt.Errorf("invalid probe target %s: %v", t.Host, err)
+		}
+	case ProbeHttp:
+		if u, err := url.Parse(t.Host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid probe target %s: http(s) url is required", t.Host)
+		}
+	default:
+		return fmt.Errorf("invalid probe type %s of %s", t.Type, t.Host)
+	}
+	if t.GetHostname() == "" {
+		return fmt.Errorf("invalid probe target %s: host is required", t.Host)
+	}
+	if t.Name == "" {
+		t.Name = t.Host
+	}
+	if t.Count <= 0 {
+		t.Count = 5
+		if t.Type == ProbeHttp {
+			t.Count = 1
+		}
+	}
+	//the probes of a round are sent in one second
+	if t.Type == ProbeIcmp && t.Count > maxIcmpProbeCount {
+		t.Count = maxIcmpProbeCount
+	}
+	return nil
+}
+
+// Types of the logcat rules
+const (
+	LogcatCounter = "counter" //number of the matched lines in the interval
+	LogcatGauge   = "gauge"   //value of the first capture group, a duration like 105.2ms is converted to milliseconds
+	LogcatEvent   = "event"   //the matched line is recorded as a timeline event
+)
+
+// Aggregations of the gauge values matched in an interval
+const (
+	AggregateLast = "last"
+	AggregateMax  = "max"
+	AggregateAvg  = "avg"
+)
+
+var rLogcatRuleName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// LogcatRule extracts a column or an event from the logcat lines of the monitored app
+type LogcatRule struct {
+	Name         string `json:"name"`          //column or event name
+	Type         string `json:"type"`          //counter, gauge or event
+	Tag          string `json:"tag"`           //log tag to match, any tag if empty
+	Pattern      string `json:"pattern"`       //regexp matched against the message, a gauge captures a value or a comma separated list summed up
+	Aggregate    string `json:"aggregate"`     //last, max or avg of the gauge values in the interval, last by default
+	AllProcesses bool   `json:"all_processes"` //match the lines of other processes which mention the monitored package, e.g. ANR of system_server
+}
+
+func (t *LogcatRule) validate() error {
+	if !rLogcatRuleName.MatchString(t.Name) {
+		return fmt.Errorf("invalid logcat rule name %s: lowercase letters, digits and _ are allowed", t.Name)
+	}
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid logcat rule %s: %v", t.Name, err)
+	}
+	switch t.Type {
+	case LogcatCounter, LogcatEvent:
+	case LogcatGauge:
+		if re.NumSubexp() < 1 {
+			return fmt.Errorf("invalid logcat rule %s: gauge needs a capture group", t.Name)
+		}
+		if t.Aggregate == "" {
+			t.Aggregate = AggregateLast
+		}
+		if t.Aggregate != AggregateLast && t.Aggregate != AggregateMax && t.Aggregate != AggregateAvg {
+			return fmt.Errorf("invalid aggregate %s of logcat rule %s", t.Aggregate, t.Name)
+		}
+	default:
+		return fmt.Errorf("invalid type %s of logcat rule %s", t.Type, t.Name)
+	}
+	return nil
+}
+
+// builtinLogcatRules are always applied besides the configured rules
+var builtinLogcatRules = []*LogcatRule{
+	{Name: "gc", Type: LogcatCounter, Pattern: `GC freed .* paused`},
+	{Name: "gc_pause", Type: LogcatGauge, Pattern: `GC freed .* paused (\d+(?:\.\d+)?[num]?s(?:,\d+(?:\.\d+)?[num]?s)*)`, Aggregate: AggregateMax},
+	{Name: "anr", Type: LogcatEvent, Tag: "ActivityManager", Pattern: `^ANR in `, AllProcesses: true},
+	{Name: "crash", Type: LogcatEvent, Tag: "AndroidRuntime", Pattern: `^FATAL EXCEPTION`},
+}
+
+// Config is the optional json config file given by -conf
+type Config struct {
+	Network     NetworkConfig  `json:"network"`
+	Probes      []*ProbeTarget `json:"probes"`
+	LogcatRules []*LogcatRule  `json:"logcat_rules"`
+}
+
+var defaultProbeTargets = []*ProbeTarget{{Name: "baidu", Type: ProbeIcmp, Host: "www.baidu.com", Count: 5}}
+
+// GetProbeTargets returns the configured probe targets, www.baidu.com is probed by default
+func (t *Config) GetProbeTargets() []*ProbeTarget {
+	if len(t.Probes) == 0 {
+		return defaultProbeTargets
+	}
+	return t.Probes
+}
+
+// GetLogcatRules returns the builtin rules of ART GC pauses, ANR and crashes followed by the configured rules
+func (t *Config) GetLogcatRules() []*LogcatRule {
+	return append(append([]*LogcatRule{}, builtinLogcatRules...), t.LogcatRules...)
+}
+
+// defaultInterfaces avoids double counting, the traffic of rmnet_data* is also counted by its carrier rmnet_ipa*,
+// and the traffic of VPN tunnels (tun*) and USB tethering (rndis*) also passes the wlan or mobile interfaces
+func defaultInterfaces() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"*"}
+	}
+	return []string{"rmnet_data*", "ccmni*", "wlan*", "eth*"}
+}
+
+func (t *NetworkConfig) GetIncludePatterns() []string {
+	if len(t.Include) == 0 {
+		return defaultInterfaces()
+	}
+	return t.Include
+}
+
+func (t *NetworkConfig) GetExcludePatterns() []string {
+	if len(t.Exclude) == 0 && len(t.Include) == 0 && runtime.GOOS == "windows" {
+		return []string{"Loopback Pseudo-Interface*"}
+	}
+	return t.Exclude
+}
+
+// MatchInterface checks whether the interface is counted in the network traffic
+func (t *NetworkConfig) MatchInterface(name string) bool {
+	isIncluded := false
+	for _, pattern := range t.GetIncludePatterns() {
+		if matched, _ := path.Match(pattern, name); matched {
+			isIncluded = true
+			break
+		}
+	}
+	if !isIncluded {
+		return false
+	}
+	for _, pattern := range t.GetExcludePatterns() {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+	return true
+}
+
+var config Config
+
+// LoadConfig loads the json config file, the defaults are used if the filename is empty
+func LoadConfig(filename string) error {
+	if filename == "" {
+		return nil
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("invalid config %s: %v", filename, err)
+	}
+	for _, pattern := range append(append([]string{}, config.Network.Include...), config.Network.Exclude...) {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid interface pattern %s: %v", pattern, err)
+		}
+	}
+	probeNames := make(map[string]bool)
+	for _, target := range config.Probes {
+		if err = target.validate(); err != nil {
+			return err
+		}
+		if probeNames[target.Name] {
+			return fmt.Errorf("duplicate probe target %s", target.Name)
+		}
+		probeNames[target.Name] = true
+	}
+	ruleNames := make(map[string]bool)
+	for _, rule := range builtinLogcatRules {
+		ruleNames[rule.Name] = true
+	}
+	for _, rule := range config.LogcatRules {
+		if err = rule.validate(); err != nil {
+			return err
+		}
+		if ruleNames[rule.Name] {
+			return fmt.Errorf("duplicate logcat rule %s", rule.Name)
+		}
+		ruleNames[rule.Name] = true
+	}
+	return nil
+}
+
+func GetConfig() *Config {
+	return &config
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchInterface(t *testing.T) {
+	networkConfig := NetworkConfig{}
+	cases := map[string]bool{"wlan0": true, "rmnet_data0": true, "rmnet_ipa0": false, "eth0": true, "tun0": false, "lo": false}
+	for name, expect := range cases {
+		if networkConfig.MatchInterface(name) != expect {
+			t.Errorf("ERROR: default %s, expect %v", name, expect)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "romstat.json")
+	if err := os.WriteFile(filename, []byte(`{"network": {"include": ["wlan*", "tun*", "rndis*"], "exclude": ["wlan1"], "per_interface": ["tun0"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { config = Config{} }()
+	networkConfig = GetConfig().Network
+	cases = map[string]bool{"wlan0": true, "wlan1": false, "tun0": true, "rndis0": true, "rmnet_data0": false}
+	for name, expect := range cases {
+		if networkConfig.MatchInterface(name) != expect {
+			t.Errorf("ERROR: configured %s, expect %v", name, expect)
+		}
+	}
+
+	if err := os.WriteFile(filename, []byte(`{"network": {"exclude": ["wlan["]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(filename); err == nil {
+		t.Error("ERROR: invalid pattern should be rejected")
+	}
+}
+
+func TestProbeTargets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "romstat.json")
+	defer func() { config = Config{} }()
+	cases := map[string]bool{
+		`{"probes": [{"host": "edge.example.com"}, {"type": "http", "host": "https://edge.example.com/health"}]}`:                  true,
+		`{"probes": [{"type": "tcp", "host": "edge.example.com"}]}`:                                                                false,
+		`{"probes": [{"type": "http", "host": "edge.example.com"}]}`:                                                               false,
+		`{"probes": [{"type": "quic", "host": "edge.example.com:443"}]}`:                                                           false,
+		`{"probes": [{"host": "edge.example.com"}, {"type": "udp", "host": "edge.example.com:7777", "name": "edge.example.com"}]}`: false,
+	}
+	for content, expect := range cases {
+		config = Config{}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadConfig(filename); (err == nil) != expect {
+			t.Errorf("ERROR: %s err=%v, expect valid %v", content, err, expect)
+		}
+	}
+	config = Config{}
+	if err := os.WriteFile(filename, []byte(`{"probes": [{"type": "http", "host": "https://edge.example.com/health"}, {"host": "10.0.0.1"}, `+
+		`{"host": "10.0.0.2", "count": 10}, {"type": "tcp", "host": "10.0.0.3:443", "count": 10}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	targets := GetConfig().GetProbeTargets()
+	if targets[0].Count != 1 || targets[1].Count != 5 || targets[1].Type != ProbeIcmp || targets[1].Name != "10.0.0.1" {
+		t.Errorf("ERROR: targets=%+v %+v, expect the defaults", *targets[0], *targets[1])
+	}
+	if targets[2].Count != 5 || targets[3].Count != 10 {
+		t.Errorf("ERROR: counts=%d %d, expect the icmp count capped to 5", targets[2].Count, targets[3].Count)
+	}
+}
+
+func TestLogcatRules(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "romstat.json")
+	defer func() { config = Config{} }()
+	cases := map[string]bool{
+		`{"logcat_rules": [{"name": "decode_fps", "type": "gauge", "pattern": "fps=(\\d+)"}, {"name": "lag", "type": "event", "pattern": "lag"}]}`: true,
+		`{"logcat_rules": [{"name": "decode_fps", "type": "gauge", "pattern": "fps=\\d+"}]}`:                                                       false,
+		`{"logcat_rules": [{"name": "decode_fps", "type": "gauge", "pattern": "fps=(\\d+)", "aggregate": "p99"}]}`:                                 false,
+		`{"logcat_rules": [{"name": "Decode FPS", "type": "counter", "pattern": "fps"}]}`:                                                          false,
+		`{"logcat_rules": [{"name": "lag", "type": "counter", "pattern": "lag("}]}`:                                                                false,
+		`{"logcat_rules": [{"name": "gc", "type": "counter", "pattern": "GC"}]}`:                                                                   false,
+	}
+	for content, expect := range cases {
+		config = Config{}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadConfig(filename); (err == nil) != expect {
+			t.Errorf("ERROR: %s err=%v, expect valid %v", content, err, expect)
+		}
+	}
+	config = Config{}
+	if err := os.WriteFile(filename, []byte(`{"logcat_rules": [{"name": "decode_fps", "type": "gauge", "pattern": "fps=(\\d+)"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	rules := GetConfig().GetLogcatRules()
+	if last := rules[len(rules)-1]; last.Name != "decode_fps" || last.Aggregate != AggregateLast {
+		t.Errorf("ERROR: rule=%+v, expect the configured rule after the builtin rules", *last)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package data
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+const packagesListPath = "/data/system/packages.list"
+
+// TargetProcess is a running process of the monitored package
+type TargetProcess struct {
+	Pid  int32
+	Name string //full process name from the cmdline, e.g. com.tencent.mm:push
+}
+
+// ParsePackagesList finds the uid of the package in /data/system/packages.list,
+// a line is 'name uid debuggable dataDir seinfo gids ...'
+func ParsePackagesList(content string, pkgName string) (int32, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != pkgName {
+			continue
+		}
+		uid, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return int32(uid), true
+	}
+	return 0, false
+}
+
+// ParsePmPackagesUid finds the uid of the package in the output of 'pm list packages -U',
+// a line is 'package:com.tencent.mm uid:10123', and 'uid:10123,1010123' for multiple users
+func ParsePmPackagesUid(output string, pkgName string) (int32, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "package:"+pkgName || !strings.HasPrefix(fields[1], "uid:") {
+			continue
+		}
+		uidList := strings.Split(strings.TrimPrefix(fields[1], "uid:"), ",")
+		uid, err := strconv.ParseInt(uidList[0], 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return int32(uid), true
+	}
+	return 0, false
+}
+
+// IsPackageProcess checks whether the process name belongs to the package, the sub processes are named 'pkg:name'
+func IsPackageProcess(processName string, pkgName string) bool {
+	return processName == pkgName || strings.HasPrefix(processName, pkgName+":")
+}
+
+// getPackageUid resolves the uid of the package, packages.list is only readable for root and system,
+// 'pm list packages -U' is used for the others
+func getPackageUid(pkgName string) (int32, bool) {
+	if content, err := os.ReadFile(packagesListPath); err == nil {
+		if uid, ok := ParsePackagesList(string(content), pkgName); ok {
+			return uid, true
+		}
+	}
+	output, err := exec.Command("pm", "list", "packages", "-U", pkgName).Output()
+	if err != nil {
+		return 0, false
+	}
+	return ParsePmPackagesUid(string(output), pkgName)
+}
+
+// getProcessName returns the full process name, comm is truncated to 15 characters by the kernel
+func getProcessName(p *process.Process) string {
+	if cmdline, err := p.CmdlineSlice(); err == nil && len(cmdline) > 0 && cmdline[0] != "" {
+		return cmdline[0]
+	}
+	name, _ := p.Name()
+	return name
+}
+
+// listTargetProcesses lists the processes of the uid, the processes are matched by name if the uid is unknown
+func listTargetProcesses(pkgName string, uid int32, hasUid bool) []*TargetProcess {
+	ret := make([]*TargetProcess, 0)
+	allProcesses, err := process.Processes()
+	if err != nil {
+		return ret
+	}
+	for _, p := range allProcesses {
+		if hasUid {
+			uids, err := p.Uids()
+			if err != nil || len(uids) == 0 || uids[0] != uid {
+				continue
+			}
+			//skip the kernel threads and the zombies which have no cmdline
+			if name := getProcessName(p); name != "" {
+				ret = append(ret, &TargetProcess{Pid: p.Pid, Name: name})
+			}
+		} else if name := getProcessName(p); IsPackageProcess(name, pkgName) {
+			ret = append(ret, &TargetProcess{Pid: p.Pid, Name: name})
+		}
+	}
+	return ret
+}
+
+type targetCache struct {
+	mutex       sync.Mutex
+	pkgName     string
+	uid         int32
+	hasUid      bool
+	processes   []*TargetProcess
+	lastUpdated time.Time
+}
+
+var target targetCache
+
+// refresh resolves the uid once per package and lists the processes at most once per 2 seconds
+func (t *targetCache) refresh(pkgName string) {
+	if pkgName != t.pkgName {
+		t.pkgName = pkgName
+		t.uid, t.hasUid = 0, false
+		if pkgName != "" {
+			t.uid, t.hasUid = getPackageUid(pkgName)
+		}
+		t.lastUpdated = time.Time{}
+	}
+	if time.Since(t.lastUpdated) < 2*time.Second {
+		return
+	}
+	t.lastUpdated = time.Now()
+	t.processes = make([]*TargetProcess, 0)
+	if pkgName != "" {
+		t.processes = listTargetProcesses(pkgName, t.uid, t.hasUid)
+	}
+}
+
+// GetUid returns the uid of the monitored package, false if it cannot be resolved
+func (t *CmdlineParameters) GetUid() (int32, bool) {
+	monitorPkgName := t.GetMonitorPkgName()
+	target.mutex.Lock()
+	defer target.mutex.Unlock()
+	target.refresh(monitorPkgName)
+	return target.uid, target.hasUid
+}
+
+// GetTargetProcesses returns all running processes of the monitored package uid,
+// including the sub processes like ':push' and the processes of the packages sharing the uid
+func (t *CmdlineParameters) GetTargetProcesses() []*TargetProcess {
+	monitorPkgName := t.GetMonitorPkgName()
+	target.mutex.Lock()
+	defer target.mutex.Unlock()
+	target.refresh(monitorPkgName)
+	return target.processes
+}
+
+// GetPids returns the pids of all running processes of the monitored package uid
+func (t *CmdlineParameters) GetPids() []int32 {
+	pids := make([]int32, 0)
+	for _, p := range t.GetTargetProcesses() {
+		pids = append(pids, p.Pid)
+	}
+	return pids
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestPackageUid(t *testing.T) {
+	packagesList := "com.android.shell 2000 0 /data/user_de/0/com.android.shell platform:privapp:targetSdkVersion=30 3002,3003 0 30\n" +
+		"com.tencent.mm 10123 0 /data/user/0/com.tencent.mm default:targetSdkVersion=29 3003 0 1 1 com.android.vending\n" +
+		"com.tencent.mmx 10124 0 /data/user/0/com.tencent.mmx default:targetSdkVersion=29 none 0 1 1 @system\n"
+	if uid, ok := ParsePackagesList(packagesList, "com.tencent.mm"); !ok || uid != 10123 {
+		t.Errorf("ERROR: uid=%d %v, expect 10123", uid, ok)
+	}
+	if _, ok := ParsePackagesList(packagesList, "com.tencent"); ok {
+		t.Error("ERROR: com.tencent should not be found")
+	}
+
+	pmOutput := "package:com.tencent.mmx uid:10124\npackage:com.tencent.mm uid:10123,1010123\n"
+	if uid, ok := ParsePmPackagesUid(pmOutput, "com.tencent.mm"); !ok || uid != 10123 {
+		t.Errorf("ERROR: uid=%d %v, expect 10123", uid, ok)
+	}
+	if _, ok := ParsePmPackagesUid("Error: unknown option -U\n", "com.tencent.mm"); ok {
+		t.Error("ERROR: uid should not be resolved")
+	}
+}
+
+func TestIsPackageProcess(t *testing.T) {
+	cases := map[string]bool{
+		"com.tencent.mm":       true,
+		"com.tencent.mm:push":  true,
+		"com.tencent.mm:tools": true,
+		"com.tencent.mmx":      false,
+		"m.tencent.mm:push":    false,
+	}
+	for name, expect := range cases {
+		if IsPackageProcess(name, "com.tencent.mm") != expect {
+			t.Errorf("ERROR: %s, expect %v", name, expect)
+		}
+	}
+}
@@ -8,3 +8,9 @@ type PluginType struct {
 	DisplayName string
 	IsCmdShow   bool
 }
+
+type PluginEvent struct {
+	TimeStamp int64 //unix milliseconds
+	Name      string
+	Detail    string
+}
@@ -38,6 +38,21 @@ func LoadAllPlugins() {
 	RegPlugin("display", new(plugins.SfLatencyStatPlugin))
 	RegPlugin("network", new(plugins.NetworkStatPlugin))
 	RegPlugin("ping", new(plugins.NetworkPingPlugin))
+	RegPlugin("cpu", new(plugins.CpuStatPlugin))
+	RegPlugin("thread", new(plugins.ThreadStatPlugin))
+	RegPlugin("gpu", new(plugins.GpuStatPlugin))
+	RegPlugin("thermal", new(plugins.ThermalStatPlugin))
+	RegPlugin("battery", new(plugins.BatteryStatPlugin))
+	RegPlugin("memory", new(plugins.MemoryStatPlugin))
+	RegPlugin("io", new(plugins.IoStatPlugin))
+	RegPlugin("sched", new(plugins.SchedStatPlugin))
+	RegPlugin("psi", new(plugins.PsiStatPlugin))
+	RegPlugin("process", new(plugins.ProcessStatPlugin))
+	RegPlugin("tcp", new(plugins.TcpStatPlugin))
+	RegPlugin("radio", new(plugins.RadioStatPlugin))
+	RegPlugin("video", new(plugins.VideoStatPlugin))
+	RegPlugin("audio", new(plugins.AudioStatPlugin))
+	RegPlugin("logcat", new(plugins.LogcatStatPlugin))
 }
 
 func UnloadPlugins() {
@@ -0,0 +1,243 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// the columns from Server of the playback track: Server FrmCnt FrmRdy F Underruns Flushed,
+// F is the filling status letter, the counts may be followed by a flag character
+var rAudioTrackServer = regexp.MustCompile(`\s[0-9A-Fa-f]{8}\s+(\d+)\S?\s+(\d+)\S?\s+[A-Za-z]\s+(\d+)\S?\s+\d+`)
+
+// Coded track states of AudioFlinger
+var audioTrackStateNames = map[string]string{
+	"A": "ACTIVE", "I": "IDLE", "S": "STOPPED", "s": "STOPPING", "5": "STOPPING", "P": "PAUSED", "p": "PAUSING",
+	"F": "FLUSHED", "r": "RESUMING", "r1": "STARTING", "r2": "STARTING",
+}
+
+type AudioTrackInfo struct {
+	Id         int
+	Pid        int32 //client pid
+	Active     bool
+	State      string //coded state, e.g. A
+	SampleRate int
+	FrameCount int //buffer size in frames
+	Underruns  int64
+}
+
+// parseAudioTrack parses a track row of the output thread, Port Id is added to the columns in android 11
+func parseAudioTrack(line string, hasPortId bool) *AudioTrackInfo {
+	server := rAudioTrackServer.FindStringSubmatch(line)
+	if len(server) < 4 {
+		return nil
+	}
+	fields := strings.Fields(line)
+	activeIdx := -1
+	for idx, field := range fields {
+		if field == "yes" || field == "no" {
+			activeIdx = idx
+			break
+		}
+	}
+	stateIdx := activeIdx + 3
+	if hasPortId {
+		stateIdx += 1
+	}
+	if activeIdx < 1 || stateIdx+4 >= len(fields) {
+		return nil
+	}
+	ret := &AudioTrackInfo{Active: fields[activeIdx] == "yes", State: fields[stateIdx]}
+	ret.Id, _ = strconv.Atoi(fields[activeIdx-1])
+	pid, _ := strconv.Atoi(fields[activeIdx+1])
+	ret.Pid = int32(pid)
+	ret.SampleRate, _ = strconv.Atoi(fields[stateIdx+4])
+	ret.FrameCount, _ = strconv.Atoi(server[1])
+	ret.Underruns, _ = strconv.ParseInt(server[3], 10, 64)
+	return ret
+}
+
+// ParseAudioFlingerTracks parses the tracks of the output threads in 'dumpsys media.audio_flinger'
+func ParseAudioFlingerTracks(output string) []*AudioTrackInfo {
+	ret := make([]*AudioTrackInfo, 0)
+	var isOutput, inTracks, hasPortId bool
+	for _, line := range strings.Split(output, "\n") {
+		//the fast track row starts with its index, e.g. F1
+		if line != "" && line[0] != ' ' && !inTracks {
+			isOutput = strings.HasPrefix(line, "Output thread")
+			continue
+		}
+		if !isOutput {
+			continue
+		}
+		if strings.Contains(line, " Active ") && strings.Contains(line, "Underruns") {
+			inTracks, hasPortId = true, strings.Contains(line, "Port Id")
+			continue
+		}
+		if !inTracks {
+			continue
+		}
+		track := parseAudioTrack(line, hasPortId)
+		if track == nil {
+			inTracks = false
+			continue
+		}
+		ret = append(ret, track)
+	}
+	return ret
+}
+
+func audioTrackStateName(state string) string {
+	if name, ok := audioTrackStateNames[state]; ok {
+		return name
+	}
+	return state
+}
+
+// audioCollectSeconds is the cadence of the collection, the dump locks AudioFlinger and the playback threads
+const audioCollectSeconds = 3
+
+type AudioStatPlugin struct {
+	EventRecorder
+
+	shell         *utils.AndroidShell
+	lock          sync.Mutex
+	lastUnderruns map[int]int64 //underruns of every track, nil before the first collection
+
+	tracks    int             //active tracks of the app
+	mainTrack *AudioTrackInfo //the track with the most underruns in the interval, or the first active track
+	underruns int64           //underruns of the app since the last sample
+
+	burstIntervals int //intervals of the underrun burst, 0 if not in a burst
+	burstUnderruns int64
+}
+
+func (t *AudioStatPlugin) Open() bool {
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	return true
+}
+
+func (t *AudioStatPlugin) Close() {
+}
+
+func (t *AudioStatPlugin) Run() {
+	go utils.SetTimer(audioCollectSeconds, t.collectAudioStat)
+}
+
+func (t *AudioStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "audio_tracks", DisplayName: "audioTracks", IsCmdShow: false},
+		{Name: "audio_state", DisplayName: "audioState", IsCmdShow: false},
+		{Name: "audio_srate", DisplayName: "sampleRate", IsCmdShow: false},
+		{Name: "audio_buffer", DisplayName: "audioBuffer", IsCmdShow: false},
+		{Name: "audio_underruns", DisplayName: "underruns", IsCmdShow: true},
+	}
+}
+
+// collectAudioStat collects the tracks of the monitored app, all tracks if no app is monitored
+func (t *AudioStatPlugin) collectAudioStat() {
+	if !data.GetCmdParameters().IsPkgResolved() {
+		t.reset()
+		return
+	}
+	isMonitorPkg := len(data.GetCmdParameters().GetPkgPatterns()) > 0
+	tracks := ParseAudioFlingerTracks(t.shell.RunShell("dumpsys media.audio_flinger"))
+	if !isMonitorPkg {
+		t.update(tracks)
+		return
+	}
+	pids := make(map[int32]bool)
+	for _, pid := range data.GetCmdParameters().GetPids() {
+		pids[pid] = true
+	}
+	appTracks := make([]*AudioTrackInfo, 0)
+	for _, track := range tracks {
+		if pids[track.Pid] {
+			appTracks = append(appTracks, track)
+		}
+	}
+	t.update(appTracks)
+}
+
+// reset drops the tracks, the columns are empty until the next collection
+func (t *AudioStatPlugin) reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastUnderruns, t.tracks, t.mainTrack, t.underruns = nil, 0, nil, 0
+	t.burstIntervals, t.burstUnderruns = 0, 0
+}
+
+// update computes the underruns in the interval and records the underrun bursts
+func (t *AudioStatPlugin) update(tracks []*AudioTrackInfo) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	lastUnderruns := make(map[int]int64)
+	var activeTracks int
+	var underruns, mainUnderruns int64
+	var mainTrack *AudioTrackInfo
+	for _, track := range tracks {
+		lastUnderruns[track.Id] = track.Underruns
+		//the underruns before the first collection are not counted, the new track is counted from 0
+		var delta int64
+		if last, ok := t.lastUnderruns[track.Id]; ok && track.Underruns >= last {
+			delta = track.Underruns - last
+		} else if t.lastUnderruns != nil {
+			delta = track.Underruns
+		}
+		underruns += delta
+		if track.Active {
+			activeTracks += 1
+		}
+		if mainTrack == nil || delta > mainUnderruns || (delta == mainUnderruns && track.Active && !mainTrack.Active) {
+			mainTrack, mainUnderruns = track, delta
+		}
+	}
+
+	if underruns > 0 {
+		if t.burstIntervals == 0 {
+			t.RecordEvent("audio_underrun_start", fmt.Sprintf("track=%d state=%s underruns=%d", mainTrack.Id, audioTrackStateName(mainTrack.State), underruns))
+		}
+		t.burstIntervals += 1
+		t.burstUnderruns += underruns
+	} else if t.burstIntervals > 0 {
+		t.RecordEvent("audio_underrun_end", fmt.Sprintf("underruns=%d duration=%ds", t.burstUnderruns, t.burstIntervals*audioCollectSeconds))
+		t.burstIntervals, t.burstUnderruns = 0, 0
+	}
+
+	t.lastUnderruns = lastUnderruns
+	t.tracks = activeTracks
+	t.mainTrack = mainTrack
+	t.underruns += underruns
+}
+
+// GetData reports the underruns once, the collection is slower than the samples
+func (t *AudioStatPlugin) GetData() map[string]string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := make(map[string]string)
+	for _, name := range []string{"audio_tracks", "audio_state", "audio_srate", "audio_buffer", "audio_underruns"} {
+		ret[name] = ""
+	}
+	if t.lastUnderruns == nil {
+		return ret
+	}
+	ret["audio_tracks"] = strconv.Itoa(t.tracks)
+	ret["audio_underruns"] = strconv.FormatInt(t.underruns, 10)
+	t.underruns = 0
+	if track := t.mainTrack; track != nil {
+		ret["audio_state"] = audioTrackStateName(track.State)
+		ret["audio_srate"] = strconv.Itoa(track.SampleRate)
+		ret["audio_buffer"] = strconv.Itoa(track.FrameCount)
+	}
+	return ret
+}
@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseAudioFlingerTracks(t *testing.T) {
+	cases := []struct {
+		filename string
+		expect   []AudioTrackInfo
+	}{
+		{"testdata/audio_flinger_android10.txt", []AudioTrackInfo{
+			{Id: 112, Pid: 12345, Active: true, State: "A", SampleRate: 48000, FrameCount: 3840, Underruns: 37},
+			{Id: 118, Pid: 2301, Active: false, State: "S", SampleRate: 44100, FrameCount: 3528, Underruns: 0},
+			{Id: 120, Pid: 12345, Active: false, State: "I", SampleRate: 48000, FrameCount: 1920, Underruns: 0},
+		}},
+		{"testdata/audio_flinger_android13.txt", []AudioTrackInfo{
+			{Id: 197, Pid: 23456, Active: false, State: "P", SampleRate: 44100, FrameCount: 14144, Underruns: 0},
+			{Id: 198, Pid: 23456, Active: true, State: "A", SampleRate: 48000, FrameCount: 3848, Underruns: 12},
+			{Id: 201, Pid: 3020, Active: true, State: "A", SampleRate: 48000, FrameCount: 720, Underruns: 0},
+		}},
+	}
+	for _, v := range cases {
+		output, err := os.ReadFile(v.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracks := ParseAudioFlingerTracks(string(output))
+		if len(tracks) != len(v.expect) {
+			t.Errorf("ERROR: %s tracks=%d, expect %d", v.filename, len(tracks), len(v.expect))
+			continue
+		}
+		for idx, track := range tracks {
+			if *track != v.expect[idx] {
+				t.Errorf("ERROR: %s track=%+v, expect %+v", v.filename, *track, v.expect[idx])
+			}
+		}
+	}
+}
+
+func TestAudioUnderrunBurst(t *testing.T) {
+	plugin := &AudioStatPlugin{}
+	for _, underruns := range []int64{5, 5, 8, 20, 20, 21} {
+		plugin.update([]*AudioTrackInfo{{Id: 198, Active: true, State: "A", SampleRate: 48000, FrameCount: 3848, Underruns: underruns}})
+	}
+	if ret := plugin.GetData(); ret["audio_underruns"] != "16" {
+		t.Errorf("ERROR: data=%v, expect 16 underruns since the start", ret)
+	}
+	//a new track is counted from 0
+	plugin.update([]*AudioTrackInfo{{Id: 199, Active: true, State: "A", Underruns: 2}})
+	events := plugin.GetEvents()
+	expect := []string{
+		"audio_underrun_start track=198 state=ACTIVE underruns=3",
+		"audio_underrun_end underruns=15 duration=6s",
+		"audio_underrun_start track=198 state=ACTIVE underruns=1",
+	}
+	if len(events) != len(expect) {
+		t.Fatalf("ERROR: events=%d, expect %v", len(events), expect)
+	}
+	for idx, event := range events {
+		if event.Name+" "+event.Detail != expect[idx] {
+			t.Errorf("ERROR: event=%s %s, expect %s", event.Name, event.Detail, expect[idx])
+		}
+	}
+	if ret := plugin.GetData(); ret["audio_underruns"] != "2" || ret["audio_tracks"] != "1" {
+		t.Errorf("ERROR: data=%v, expect 2 underruns of 1 track", ret)
+	}
+	//the underruns are reported once
+	if ret := plugin.GetData(); ret["audio_underruns"] != "0" {
+		t.Errorf("ERROR: data=%v, expect no underruns in the next sample", ret)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// batteryUnitSamples is the count of the non-zero samples to detect the unit of current_now
+const batteryUnitSamples = 5
+
+// DetectBatteryCurrentUnit detects whether current_now is in µA by the first samples, vendors report it in µA or mA.
+// A phone never draws more than 10A and draws more than 10mA in use, so the current is in µA once a sample
+// is above 10000, and in mA if none of the first non-zero samples is; isDetected is false until then
+func DetectBatteryCurrentUnit(samples []int64) (isMicroAmp bool, isDetected bool) {
+	count := 0
+	for _, sample := range samples {
+		if math.Abs(float64(sample)) > 10000 {
+			return true, true
+		}
+		if sample != 0 {
+			count++
+		}
+	}
+	return false, count >= batteryUnitSamples
+}
+
+// NormalizeBatteryCurrent converts current_now to mA by the unit of the device,
+// discharging is negative on some devices and positive on others
+func NormalizeBatteryCurrent(current int64, isMicroAmp bool) float64 {
+	val := math.Abs(float64(current))
+	if isMicroAmp {
+		return val / 1000
+	}
+	return val
+}
+
+// NormalizeBatteryVoltage converts voltage_now to mV, vendors report it in µV or mV
+func NormalizeBatteryVoltage(voltage int64) float64 {
+	val := math.Abs(float64(voltage))
+	if val > 100000 {
+		return val / 1000
+	}
+	return val
+}
+
+// NormalizeBatteryTemperature converts the battery temp to degree celsius, it is in 0.1 degree usually
+func NormalizeBatteryTemperature(temp int64) float64 {
+	if temp > 1000 || temp < -1000 { //millidegree
+		return float64(temp) / 1000
+	}
+	return float64(temp) / 10
+}
+
+type BatteryStatPlugin struct {
+	EventRecorder
+
+	sysRoot     string //root of the sysfs, '/' for the device
+	batteryPath string
+
+	lastCollected time.Time
+	isCharging    bool
+
+	unitSamples    []int64 //the first samples of current_now, they are dropped once the unit is detected
+	isMicroAmp     bool    //current_now is in µA, it is kept for the session once detected
+	isUnitDetected bool
+
+	current     float64 //mA
+	voltage     float64 //mV
+	power       float64 //mW
+	level       int64   //percent
+	temperature float64 //degree celsius
+	status      string
+
+	energy           float64       //consumed energy of the session while discharging, mWh
+	dischargeElapsed time.Duration //duration of the session while discharging
+}
+
+func (t *BatteryStatPlugin) discoverBattery() string {
+	batteryPath := filepath.Join(t.sysRoot, "sys/class/power_supply/battery")
+	if utils.CheckFileIsExist(batteryPath) {
+		return batteryPath
+	}
+	supplyPaths, _ := filepath.Glob(filepath.Join(t.sysRoot, "sys/class/power_supply/*"))
+	for _, supplyPath := range supplyPaths {
+		if utils.ReadFileString(filepath.Join(supplyPath, "type")) == "Battery" {
+			return supplyPath
+		}
+	}
+	return ""
+}
+
+func (t *BatteryStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	t.batteryPath = t.discoverBattery()
+	return t.batteryPath != ""
+}
+
+func (t *BatteryStatPlugin) Close() {
+}
+
+func (t *BatteryStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectBatteryStat)
+}
+
+func (t *BatteryStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "bat_power", DisplayName: "power(mW)", IsCmdShow: true},
+		{Name: "bat_current", DisplayName: "current(mA)", IsCmdShow: false},
+		{Name: "bat_voltage", DisplayName: "voltage(mV)", IsCmdShow: false},
+		{Name: "bat_level", DisplayName: "battery%", IsCmdShow: true},
+		{Name: "bat_temp", DisplayName: "batTemp(C)", IsCmdShow: true},
+		{Name: "bat_status", DisplayName: "batStatus", IsCmdShow: false},
+		{Name: "energy", DisplayName: "energy(mWh)", IsCmdShow: false},
+		{Name: "avg_power", DisplayName: "avgPower(mW)", IsCmdShow: false},
+	}
+}
+
+func (t *BatteryStatPlugin) collectBatteryStat() {
+	if t.batteryPath == "" {
+		return
+	}
+	current, _ := utils.ReadFileInt(filepath.Join(t.batteryPath, "current_now"))
+	voltage, _ := utils.ReadFileInt(filepath.Join(t.batteryPath, "voltage_now"))
+	temperature, _ := utils.ReadFileInt(filepath.Join(t.batteryPath, "temp"))
+	t.level, _ = utils.ReadFileInt(filepath.Join(t.batteryPath, "capacity"))
+	t.status = utils.ReadFileString(filepath.Join(t.batteryPath, "status"))
+	if !t.isUnitDetected {
+		t.unitSamples = append(t.unitSamples, current)
+		t.isMicroAmp, t.isUnitDetected = DetectBatteryCurrentUnit(t.unitSamples)
+		if t.isUnitDetected {
+			t.unitSamples = nil
+		}
+	}
+	t.current = NormalizeBatteryCurrent(current, t.isMicroAmp)
+	t.voltage = NormalizeBatteryVoltage(voltage)
+	t.power = t.current * t.voltage / 1000
+	t.temperature = NormalizeBatteryTemperature(temperature)
+
+	//The power of a charging device is not the consumption of the device
+	isCharging := strings.EqualFold(t.status, "Charging") || strings.EqualFold(t.status, "Full")
+	if isCharging && !t.isCharging {
+		t.RecordEvent("charging_start", "WARNING: device is charging, power data is not the consumption of the device")
+	} else if !isCharging && t.isCharging {
+		t.RecordEvent("charging_end", t.status)
+	}
+	t.isCharging = isCharging
+
+	now := time.Now()
+	if !t.lastCollected.IsZero() && !isCharging {
+		elapsed := now.Sub(t.lastCollected)
+		t.energy += t.power * elapsed.Hours()
+		t.dischargeElapsed += elapsed
+	}
+	t.lastCollected = now
+}
+
+func (t *BatteryStatPlugin) GetData() map[string]string {
+	var avgPower float64
+	if t.dischargeElapsed > 0 {
+		avgPower = t.energy / t.dischargeElapsed.Hours()
+	}
+	return map[string]string{
+		"bat_power":   fmt.Sprintf("%.0f", t.power),
+		"bat_current": fmt.Sprintf("%.0f", t.current),
+		"bat_voltage": fmt.Sprintf("%.0f", t.voltage),
+		"bat_level":   fmt.Sprintf("%d", t.level),
+		"bat_temp":    fmt.Sprintf("%.1f", t.temperature),
+		"bat_status":  t.status,
+		"energy":      fmt.Sprintf("%.2f", t.energy),
+		"avg_power":   fmt.Sprintf("%.0f", avgPower),
+	}
+}
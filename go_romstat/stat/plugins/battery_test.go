@@ -0,0 +1,86 @@
+package plugins
+
+import (
+	"testing"
+)
+
+func TestBatteryNormalize(t *testing.T) {
+	cases := []struct {
+		current    int64
+		isMicroAmp bool
+		voltage    int64
+		power      float64
+	}{
+		{current: -850000, isMicroAmp: true, voltage: 3850000, power: 3272.5}, //µA, µV, negative when discharging
+		{current: 850000, isMicroAmp: true, voltage: 3850000, power: 3272.5},  //µA, µV, positive when discharging
+		{current: -850, voltage: 3850, power: 3272.5},                         //mA, mV
+		{current: 850, voltage: 3850000, power: 3272.5},                       //mA, µV
+		{current: -8500, isMicroAmp: true, voltage: 3850000, power: 32.725},   //µA under 10mA
+	}
+	for _, c := range cases {
+		power := NormalizeBatteryCurrent(c.current, c.isMicroAmp) * NormalizeBatteryVoltage(c.voltage) / 1000
+		if power != c.power {
+			t.Errorf("ERROR: current=%d, voltage=%d, power=%f, expect %f", c.current, c.voltage, power, c.power)
+		}
+	}
+	if temp := NormalizeBatteryTemperature(325); temp != 32.5 {
+		t.Errorf("ERROR: temp=%f, expect 32.5", temp)
+	}
+}
+
+func TestBatteryCurrentUnit(t *testing.T) {
+	cases := []struct {
+		samples    []int64
+		isMicroAmp bool
+		isDetected bool
+	}{
+		{samples: []int64{-850000}, isMicroAmp: true, isDetected: true},
+		{samples: []int64{850, 0, 920, 780, 810, 900}, isMicroAmp: false, isDetected: true},
+		{samples: []int64{850, 0, 920}, isMicroAmp: false, isDetected: false},
+		{samples: []int64{0, 0, 0, 0, 0}, isMicroAmp: false, isDetected: false},
+	}
+	for _, c := range cases {
+		isMicroAmp, isDetected := DetectBatteryCurrentUnit(c.samples)
+		if isMicroAmp != c.isMicroAmp || isDetected != c.isDetected {
+			t.Errorf("ERROR: samples=%v, isMicroAmp=%v isDetected=%v, expect %v %v", c.samples, isMicroAmp, isDetected, c.isMicroAmp, c.isDetected)
+		}
+	}
+
+	//the unit is kept once detected, the current under 10mA is still read in µA
+	root := t.TempDir()
+	writeFakeFile(t, root, "sys/class/power_supply/battery/status", "Discharging\n")
+	writeFakeFile(t, root, "sys/class/power_supply/battery/current_now", "-450000\n")
+	writeFakeFile(t, root, "sys/class/power_supply/battery/voltage_now", "4000000\n")
+	plugin := &BatteryStatPlugin{sysRoot: root}
+	if !plugin.Open() {
+		t.Fatal("ERROR: no battery found")
+	}
+	plugin.collectBatteryStat()
+	writeFakeFile(t, root, "sys/class/power_supply/battery/current_now", "-8000\n")
+	plugin.collectBatteryStat()
+	if ret := plugin.GetData(); ret["bat_current"] != "8" || ret["bat_power"] != "32" {
+		t.Errorf("ERROR: data=%v, expect 8 mA and 32 mW", ret)
+	}
+}
+
+func TestBatteryChargingEvent(t *testing.T) {
+	root := t.TempDir()
+	writeFakeFile(t, root, "sys/class/power_supply/bms/type", "Battery\n")
+	writeFakeFile(t, root, "sys/class/power_supply/bms/status", "Discharging\n")
+	writeFakeFile(t, root, "sys/class/power_supply/bms/current_now", "-1000000\n")
+	writeFakeFile(t, root, "sys/class/power_supply/bms/voltage_now", "4000000\n")
+	plugin := &BatteryStatPlugin{sysRoot: root}
+	if !plugin.Open() {
+		t.Fatal("ERROR: no battery found")
+	}
+	plugin.collectBatteryStat()
+	writeFakeFile(t, root, "sys/class/power_supply/bms/status", "Charging\n")
+	plugin.collectBatteryStat()
+	if ret := plugin.GetData(); ret["bat_power"] != "4000" || ret["bat_status"] != "Charging" {
+		t.Errorf("ERROR: data=%v, expect 4000 mW and charging", ret)
+	}
+	events := plugin.GetEvents()
+	if len(events) != 1 || events[0].Name != "charging_start" {
+		t.Errorf("ERROR: events=%v, expect one charging_start event", events)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+// counterDelta returns the increment of a counter, the reset counter is dropped
+func counterDelta(current int64, last int64) int64 {
+	if current < last {
+		return 0
+	}
+	return current - last
+}
+
+// counterRate returns the increment per second of a counter, the reset counter is dropped,
+// e.g. the counters of an interface are reset when the interface is recreated
+func counterRate(current uint64, last uint64, elapsed float64) float64 {
+	if current < last || elapsed <= 0 {
+		return 0
+	}
+	return float64(current-last) / elapsed
+}
@@ -0,0 +1,23 @@
+package plugins
+
+import (
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	if ret := counterDelta(150, 100); ret != 50 {
+		t.Errorf("ERROR: delta=%d, expect 50", ret)
+	}
+	if ret := counterDelta(20, 100); ret != 0 {
+		t.Errorf("ERROR: delta=%d, expect 0 after the reset", ret)
+	}
+	if ret := counterRate(3048, 1000, 2); ret != 1024 {
+		t.Errorf("ERROR: rate=%f, expect 1024", ret)
+	}
+	if ret := counterRate(20, 1000, 2); ret != 0 {
+		t.Errorf("ERROR: rate=%f, expect 0 after the reset", ret)
+	}
+	if ret := counterRate(3048, 1000, 0); ret != 0 {
+		t.Errorf("ERROR: rate=%f, expect 0 without elapsed time", ret)
+	}
+}
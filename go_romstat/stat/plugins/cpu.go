@@ -0,0 +1,275 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+type CpuTimes struct {
+	Total  uint64 //sum of all the time fields
+	Idle   uint64 //idle time, include iowait
+	IoWait uint64 //iowait time
+}
+
+func (t *CpuTimes) Busy() uint64 {
+	return t.Total - t.Idle
+}
+
+// ParseProcStat parses the cpu lines of /proc/stat, the key is 'cpu' for all cores and 'cpuN' for each core
+func ParseProcStat(content string) map[string]*CpuTimes {
+	ret := make(map[string]*CpuTimes)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		cpuTimes := new(CpuTimes)
+		for idx, v := range fields[1:] {
+			val, _ := strconv.ParseUint(v, 10, 64)
+			if idx >= 8 { //guest and guest_nice are already counted in user and nice
+				break
+			}
+			cpuTimes.Total += val
+			if idx == 3 || idx == 4 { //idle, iowait
+				cpuTimes.Idle += val
+			}
+			if idx == 4 {
+				cpuTimes.IoWait = val
+			}
+		}
+		ret[fields[0]] = cpuTimes
+	}
+	return ret
+}
+
+// readProcPidCpuTime returns utime + stime of the process in clock ticks
+func readProcPidCpuTime(procPath string, pid int32) (uint64, error) {
+	content, err := os.ReadFile(filepath.Join(procPath, strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	_, fields := utils.SplitProcStat(string(content))
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	return utime + stime, nil
+}
+
+type CpuCoreStat struct {
+	Online  bool
+	Usage   float64 //usage percent of the core
+	CurFreq int64   //current frequency, kHz
+	MaxFreq int64   //max frequency of the hardware, kHz
+}
+
+type CpuStatPlugin struct {
+	sysCpuPath string //root of the cpu sysfs, /sys/devices/system/cpu
+	procPath   string //root of the procfs, /proc
+
+	cores    []int //all possible cores
+	clusters []int //first core of every cpufreq policy
+
+	lastCpuTimes map[string]*CpuTimes
+	lastAppTimes map[int32]uint64 //cpu ticks of every process of the target package
+
+	lock           sync.Mutex //the stats are updated by the timer and read by GetData
+	coreStats      map[int]*CpuCoreStat
+	clusterMaxFreq map[int]int64 //current frequency limit of every cluster, kHz
+	cpuUsage       float64
+	cpuNormUsage   float64
+	appUsage       float64
+	appNormUsage   float64
+}
+
+func (t *CpuStatPlugin) discoverCores() {
+	if t.sysCpuPath == "" {
+		t.sysCpuPath = "/sys/devices/system/cpu"
+	}
+	if t.procPath == "" {
+		t.procPath = "/proc"
+	}
+	t.cores = utils.ParseCpuList(utils.ReadFileString(filepath.Join(t.sysCpuPath, "possible")))
+	t.clusters = make([]int, 0)
+	policies, _ := filepath.Glob(filepath.Join(t.sysCpuPath, "cpufreq", "policy*"))
+	for _, policy := range policies {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(policy), "policy"))
+		if err != nil {
+			continue
+		}
+		t.clusters = append(t.clusters, cpu)
+	}
+	sort.Ints(t.clusters)
+	t.coreStats = make(map[int]*CpuCoreStat)
+	for _, cpu := range t.cores {
+		maxFreq, _ := utils.ReadFileInt(filepath.Join(t.sysCpuPath, fmt.Sprintf("cpu%d", cpu), "cpufreq", "cpuinfo_max_freq"))
+		t.coreStats[cpu] = &CpuCoreStat{MaxFreq: maxFreq}
+	}
+	t.clusterMaxFreq = make(map[int]int64)
+}
+
+func (t *CpuStatPlugin) Open() bool {
+	if t.cores == nil {
+		t.discoverCores()
+	}
+	return len(t.cores) > 0
+}
+
+func (t *CpuStatPlugin) Close() {
+}
+
+func (t *CpuStatPlugin) Run() {
+	t.collectCpuStat()
+	go utils.SetTimer(1, t.collectCpuStat)
+}
+
+func (t *CpuStatPlugin) GetTypes() []*data.PluginType {
+	if t.cores == nil {
+		t.discoverCores()
+	}
+	types := []*data.PluginType{
+		{Name: "cpu_usg", DisplayName: "cpu%", IsCmdShow: true},
+		{Name: "cpu_norm", DisplayName: "cpuN%", IsCmdShow: false},
+		{Name: "app_cpu", DisplayName: "app%", IsCmdShow: false},
+		{Name: "app_cpu_norm", DisplayName: "appN%", IsCmdShow: true},
+		{Name: "cpu_online", DisplayName: "online", IsCmdShow: false},
+		{Name: "cpu_offline", DisplayName: "offline", IsCmdShow: false},
+	}
+	for _, cpu := range t.cores {
+		types = append(types,
+			&data.PluginType{Name: fmt.Sprintf("cpu%d_usg", cpu), DisplayName: fmt.Sprintf("cpu%d%%", cpu), IsCmdShow: false},
+			&data.PluginType{Name: fmt.Sprintf("cpu%d_freq", cpu), DisplayName: fmt.Sprintf("cpu%d(MHz)", cpu), IsCmdShow: false})
+	}
+	for _, cluster := range t.clusters {
+		types = append(types, &data.PluginType{Name: fmt.Sprintf("cluster%d_max_freq", cluster), DisplayName: fmt.Sprintf("c%dmax(MHz)", cluster), IsCmdShow: false})
+	}
+	return types
+}
+
+func (t *CpuStatPlugin) collectCpuStat() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	cpuTimes := ParseProcStat(utils.ReadFileString(filepath.Join(t.procPath, "stat")))
+	lastCpuTimes := t.lastCpuTimes
+	t.lastCpuTimes = cpuTimes
+
+	//frequency and online state of every core
+	for _, cpu := range t.cores {
+		coreStat := t.coreStats[cpu]
+		cpuPath := filepath.Join(t.sysCpuPath, fmt.Sprintf("cpu%d", cpu))
+		_, coreStat.Online = cpuTimes[fmt.Sprintf("cpu%d", cpu)]
+		if online, err := utils.ReadFileInt(filepath.Join(cpuPath, "online")); err == nil {
+			coreStat.Online = online == 1
+		}
+		coreStat.CurFreq = 0
+		if coreStat.Online {
+			coreStat.CurFreq, _ = utils.ReadFileInt(filepath.Join(cpuPath, "cpufreq", "scaling_cur_freq"))
+		}
+	}
+	for _, cluster := range t.clusters {
+		t.clusterMaxFreq[cluster], _ = utils.ReadFileInt(filepath.Join(t.sysCpuPath, "cpufreq", fmt.Sprintf("policy%d", cluster), "scaling_max_freq"))
+	}
+	if lastCpuTimes == nil {
+		return
+	}
+
+	//usage of every core, the busy time is weighted by the current frequency against the max frequency
+	var busyTotal, weightedBusyTotal, timeTotal float64
+	for _, cpu := range t.cores {
+		coreStat := t.coreStats[cpu]
+		coreStat.Usage = 0
+		current, ok1 := cpuTimes[fmt.Sprintf("cpu%d", cpu)]
+		last, ok2 := lastCpuTimes[fmt.Sprintf("cpu%d", cpu)]
+		if !ok1 || !ok2 || current.Total <= last.Total {
+			continue
+		}
+		busy := float64(current.Busy() - last.Busy())
+		total := float64(current.Total - last.Total)
+		coreStat.Usage = busy * 100 / total
+		weight := 1.0
+		if coreStat.MaxFreq > 0 && coreStat.CurFreq > 0 {
+			weight = float64(coreStat.CurFreq) / float64(coreStat.MaxFreq)
+		}
+		busyTotal += busy
+		weightedBusyTotal += busy * weight
+		timeTotal += total
+	}
+	normFactor := 1.0
+	if busyTotal > 0 {
+		normFactor = weightedBusyTotal / busyTotal
+	}
+	if timeTotal > 0 {
+		t.cpuNormUsage = weightedBusyTotal * 100 / timeTotal
+	}
+
+	current, ok1 := cpuTimes["cpu"]
+	last, ok2 := lastCpuTimes["cpu"]
+	if !ok1 || !ok2 || current.Total <= last.Total {
+		return
+	}
+	allTotal := float64(current.Total - last.Total)
+	t.cpuUsage = float64(current.Busy()-last.Busy()) * 100 / allTotal
+
+	//usage of all processes of the target package against all cores, same as 'cpu_usg' of the system plugin,
+	//a new process is counted from the next interval
+	t.appUsage, t.appNormUsage = 0, 0
+	appTimes := make(map[int32]uint64)
+	var appBusy uint64
+	for _, pid := range data.GetCmdParameters().GetPids() {
+		appTime, err := readProcPidCpuTime(t.procPath, pid)
+		if err != nil {
+			continue
+		}
+		appTimes[pid] = appTime
+		if lastAppTime, ok := t.lastAppTimes[pid]; ok && appTime >= lastAppTime {
+			appBusy += appTime - lastAppTime
+		}
+	}
+	t.appUsage = float64(appBusy) * 100 / allTotal
+	t.appNormUsage = t.appUsage * normFactor
+	t.lastAppTimes = appTimes
+}
+
+func (t *CpuStatPlugin) GetData() map[string]string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := map[string]string{
+		"cpu_usg":      fmt.Sprintf("%.1f", t.cpuUsage),
+		"cpu_norm":     fmt.Sprintf("%.1f", t.cpuNormUsage),
+		"app_cpu":      fmt.Sprintf("%.1f", t.appUsage),
+		"app_cpu_norm": fmt.Sprintf("%.1f", t.appNormUsage),
+	}
+	online := 0
+	offline := make([]string, 0)
+	for _, cpu := range t.cores {
+		coreStat := t.coreStats[cpu]
+		if coreStat.Online {
+			online += 1
+		} else {
+			offline = append(offline, strconv.Itoa(cpu))
+		}
+		ret[fmt.Sprintf("cpu%d_usg", cpu)] = fmt.Sprintf("%.1f", coreStat.Usage)
+		ret[fmt.Sprintf("cpu%d_freq", cpu)] = fmt.Sprintf("%d", coreStat.CurFreq/1000)
+	}
+	if !data.GetCmdParameters().IsPkgResolved() {
+		ret["app_cpu"], ret["app_cpu_norm"] = "", ""
+	}
+	ret["cpu_online"] = strconv.Itoa(online)
+	ret["cpu_offline"] = strings.Join(offline, " ")
+	for _, cluster := range t.clusters {
+		ret[fmt.Sprintf("cluster%d_max_freq", cluster)] = fmt.Sprintf("%d", t.clusterMaxFreq[cluster]/1000)
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCpuNormUsage(t *testing.T) {
+	root := t.TempDir()
+	sysCpuPath := filepath.Join(root, "sys")
+	procPath := filepath.Join(root, "proc")
+	writeFakeFile(t, sysCpuPath, "possible", "0-2")
+	writeFakeFile(t, sysCpuPath, "cpu2/online", "0")
+	writeFakeFile(t, sysCpuPath, "cpufreq/policy0/scaling_max_freq", "1800000")
+	writeFakeFile(t, sysCpuPath, "cpufreq/policy2/scaling_max_freq", "2400000")
+	for _, cpu := range []string{"cpu0", "cpu1", "cpu2"} {
+		writeFakeFile(t, sysCpuPath, cpu+"/cpufreq/cpuinfo_max_freq", "2000000")
+	}
+	writeFakeFile(t, sysCpuPath, "cpu0/cpufreq/scaling_cur_freq", "1000000")
+	writeFakeFile(t, sysCpuPath, "cpu1/cpufreq/scaling_cur_freq", "2000000")
+	writeFakeFile(t, procPath, "stat", "cpu  100 0 100 800 0 0 0 0 0 0\ncpu0 50 0 50 400 0 0 0 0 0 0\ncpu1 50 0 50 400 0 0 0 0 0 0\n")
+
+	plugin := &CpuStatPlugin{sysCpuPath: sysCpuPath, procPath: procPath}
+	if !plugin.Open() {
+		t.Fatal("ERROR: no cpu core found")
+	}
+	plugin.collectCpuStat()
+	//cpu0 and cpu1 are both 50% busy, cpu0 runs at the half of the max frequency
+	writeFakeFile(t, procPath, "stat", "cpu  200 0 200 1000 0 0 0 0 0 0\ncpu0 100 0 100 500 0 0 0 0 0 0\ncpu1 100 0 100 500 0 0 0 0 0 0\n")
+	plugin.collectCpuStat()
+
+	ret := plugin.GetData()
+	expect := map[string]string{
+		"cpu_usg":           "50.0",
+		"cpu_norm":          "37.5",
+		"cpu0_usg":          "50.0",
+		"cpu0_freq":         "1000",
+		"cpu_online":        "2",
+		"cpu_offline":       "2",
+		"cluster2_max_freq": "2400",
+		"cluster0_max_freq": "1800",
+		"cpu2_freq":         "0",
+		"cpu1_usg":          "50.0",
+	}
+	for k, v := range expect {
+		if ret[k] != v {
+			t.Errorf("ERROR: %s=%s, expect %s", k, ret[k], v)
+		}
+	}
+
+	//the timer collects while the manager reads the data
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 20; i++ {
+			plugin.collectCpuStat()
+		}
+		close(done)
+	}()
+	for isDone := false; !isDone; {
+		select {
+		case <-done:
+			isDone = true
+		default:
+			plugin.GetData()
+		}
+	}
+
+	setUnresolvedPackage(t)
+	if ret = plugin.GetData(); ret["app_cpu"] != "" || ret["app_cpu_norm"] != "" || ret["cpu_usg"] == "" {
+		t.Errorf("ERROR: data=%v, expect empty app columns before the package is resolved", ret)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"romstat/stat/data"
+)
+
+// EventRecorder keeps the timeline events of a plugin until they are collected,
+// plugins embed it to implement GetEvents
+type EventRecorder struct {
+	events    []*data.PluginEvent
+	eventLock sync.Mutex
+}
+
+func (t *EventRecorder) RecordEvent(name string, detail string) {
+	t.eventLock.Lock()
+	defer t.eventLock.Unlock()
+	t.events = append(t.events, &data.PluginEvent{
+		TimeStamp: time.Now().UnixMilli(),
+		Name:      name,
+		Detail:    detail,
+	})
+}
+
+// RecordChangeEvent records an event if the value changed, the first value is not an event,
+// and the empty value of a failed read is not a change
+func (t *EventRecorder) RecordChangeEvent(name string, oldValue string, newValue string) {
+	if oldValue == "" || newValue == "" || oldValue == newValue {
+		return
+	}
+	t.RecordEvent(name, fmt.Sprintf("%s -> %s", oldValue, newValue))
+}
+
+func (t *EventRecorder) GetEvents() []*data.PluginEvent {
+	t.eventLock.Lock()
+	defer t.eventLock.Unlock()
+	events := t.events
+	t.events = nil
+	return events
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// GpuFile is a sysfs file of a gpu metric
+type GpuFile struct {
+	Path  string                               //absolute path of the file
+	Scale float64                              //multiplier to the unit of the column, percent or MHz
+	Parse func(content string) (float64, bool) //parser of the file content
+}
+
+func (t *GpuFile) Read() (float64, bool) {
+	content := utils.ReadFileString(t.Path)
+	if content == "" {
+		return 0, false
+	}
+	val, ok := t.Parse(content)
+	return val * t.Scale, ok
+}
+
+// GpuSource is the set of the sysfs files used for gpu metrics, a file is nil if it is not found
+type GpuSource struct {
+	Name    string
+	Busy    *GpuFile
+	CurFreq *GpuFile
+	MaxFreq *GpuFile
+}
+
+var rLeadingNumber = regexp.MustCompile(`^\s*(\d+(\.\d+)?)`)
+
+// parseLeadingNumber parses the content like '23', '23 %' or '42@600000000Hz'
+func parseLeadingNumber(content string) (float64, bool) {
+	sz := rLeadingNumber.FindStringSubmatch(content)
+	if len(sz) <= 1 {
+		return 0, false
+	}
+	val, err := strconv.ParseFloat(sz[1], 64)
+	return val, err == nil
+}
+
+// parseKgslGpuBusy parses the adreno gpubusy: busy time and total time of the last sample window
+func parseKgslGpuBusy(content string) (float64, bool) {
+	fields := strings.Fields(content)
+	if len(fields) < 2 {
+		return 0, false
+	}
+	busy, err1 := strconv.ParseFloat(fields[0], 64)
+	total, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	if total <= 0 {
+		return 0, true
+	}
+	return busy / total, true
+}
+
+// findGpuFile returns the first existing file of the candidates
+func findGpuFile(candidates ...*GpuFile) *GpuFile {
+	for _, v := range candidates {
+		if utils.CheckFileIsExist(v.Path) {
+			return v
+		}
+	}
+	return nil
+}
+
+func discoverAdreno(sysRoot string) *GpuSource {
+	kgslPath := filepath.Join(sysRoot, "sys/class/kgsl/kgsl-3d0")
+	if !utils.CheckFileIsExist(kgslPath) {
+		return nil
+	}
+	return &GpuSource{
+		Name: "adreno",
+		Busy: findGpuFile(
+			&GpuFile{Path: filepath.Join(kgslPath, "gpu_busy_percentage"), Scale: 1, Parse: parseLeadingNumber},
+			&GpuFile{Path: filepath.Join(kgslPath, "gpubusy"), Scale: 100, Parse: parseKgslGpuBusy},
+		),
+		CurFreq: findGpuFile(
+			&GpuFile{Path: filepath.Join(kgslPath, "gpuclk"), Scale: 1e-6, Parse: parseLeadingNumber},
+			&GpuFile{Path: filepath.Join(kgslPath, "devfreq/cur_freq"), Scale: 1e-6, Parse: parseLeadingNumber},
+		),
+		MaxFreq: findGpuFile(
+			&GpuFile{Path: filepath.Join(kgslPath, "max_gpuclk"), Scale: 1e-6, Parse: parseLeadingNumber},
+			&GpuFile{Path: filepath.Join(kgslPath, "devfreq/max_freq"), Scale: 1e-6, Parse: parseLeadingNumber},
+		),
+	}
+}
+
+func discoverMali(sysRoot string) *GpuSource {
+	maliPath := filepath.Join(sysRoot, "sys/class/misc/mali0/device")
+	kernelGpuPath := filepath.Join(sysRoot, "sys/kernel/gpu")
+	gedPath := filepath.Join(sysRoot, "sys/kernel/ged/hal")
+	if !utils.CheckFileIsExist(maliPath) && !utils.CheckFileIsExist(kernelGpuPath) && !utils.CheckFileIsExist(gedPath) {
+		return nil
+	}
+	source := &GpuSource{
+		Name: "mali",
+		Busy: findGpuFile(
+			&GpuFile{Path: filepath.Join(kernelGpuPath, "gpu_busy"), Scale: 1, Parse: parseLeadingNumber},
+			&GpuFile{Path: filepath.Join(maliPath, "utilization"), Scale: 1, Parse: parseLeadingNumber},
+			&GpuFile{Path: filepath.Join(maliPath, "utilisation"), Scale: 1, Parse: parseLeadingNumber},
+			&GpuFile{Path: filepath.Join(gedPath, "gpu_utilization"), Scale: 1, Parse: parseLeadingNumber},
+		),
+		CurFreq: findGpuFile(
+			&GpuFile{Path: filepath.Join(kernelGpuPath, "gpu_clock"), Scale: 1, Parse: parseLeadingNumber},
+		),
+		MaxFreq: findGpuFile(
+			&GpuFile{Path: filepath.Join(kernelGpuPath, "gpu_max_clock"), Scale: 1, Parse: parseLeadingNumber},
+		),
+	}
+	//The frequency of mali is usually in the devfreq of the device
+	if devfreqPaths, _ := filepath.Glob(filepath.Join(maliPath, "devfreq", "*")); len(devfreqPaths) > 0 {
+		if source.CurFreq == nil {
+			source.CurFreq = findGpuFile(&GpuFile{Path: filepath.Join(devfreqPaths[0], "cur_freq"), Scale: 1e-6, Parse: parseLeadingNumber})
+		}
+		if source.MaxFreq == nil {
+			source.MaxFreq = findGpuFile(&GpuFile{Path: filepath.Join(devfreqPaths[0], "max_freq"), Scale: 1e-6, Parse: parseLeadingNumber})
+		}
+	}
+	return source
+}
+
+func discoverDevfreq(sysRoot string) *GpuSource {
+	devfreqPaths, _ := filepath.Glob(filepath.Join(sysRoot, "sys/class/devfreq/*"))
+	for _, devfreqPath := range devfreqPaths {
+		name := strings.ToLower(filepath.Base(devfreqPath))
+		if !strings.Contains(name, "gpu") && !strings.Contains(name, "mali") && !strings.Contains(name, "kgsl") {
+			continue
+		}
+		return &GpuSource{
+			Name: "devfreq(" + filepath.Base(devfreqPath) + ")",
+			Busy: findGpuFile(
+				&GpuFile{Path: filepath.Join(devfreqPath, "load"), Scale: 1, Parse: parseLeadingNumber},
+				&GpuFile{Path: filepath.Join(devfreqPath, "gpu_load"), Scale: 1, Parse: parseLeadingNumber},
+			),
+			CurFreq: findGpuFile(&GpuFile{Path: filepath.Join(devfreqPath, "cur_freq"), Scale: 1e-6, Parse: parseLeadingNumber}),
+			MaxFreq: findGpuFile(&GpuFile{Path: filepath.Join(devfreqPath, "max_freq"), Scale: 1e-6, Parse: parseLeadingNumber}),
+		}
+	}
+	return nil
+}
+
+// DiscoverGpuSource probes the known gpu sysfs locations under sysRoot in order:
+// adreno kgsl, mali and the generic gpu devfreq. Returns nil for unknown SoCs
+func DiscoverGpuSource(sysRoot string) *GpuSource {
+	for _, discover := range []func(string) *GpuSource{discoverAdreno, discoverMali, discoverDevfreq} {
+		source := discover(sysRoot)
+		if source != nil && (source.Busy != nil || source.CurFreq != nil) {
+			return source
+		}
+	}
+	return nil
+}
+
+type GpuStatPlugin struct {
+	sysRoot  string //root of the sysfs and procfs, '/' for the device
+	source   *GpuSource
+	debugLog utils.Logger
+
+	busy    string
+	curFreq string
+	maxFreq string
+}
+
+func (t *GpuStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	if t.debugLog == nil {
+		t.debugLog = utils.DebugLogger
+	}
+	t.source = DiscoverGpuSource(t.sysRoot)
+	if t.source == nil {
+		t.debugLog.Println("GPU: no gpu source found")
+		return false
+	}
+	for _, f := range []*GpuFile{t.source.Busy, t.source.CurFreq, t.source.MaxFreq} {
+		if f != nil {
+			t.debugLog.Println("GPU:", t.source.Name, f.Path)
+		}
+	}
+	return true
+}
+
+func (t *GpuStatPlugin) Close() {
+}
+
+func (t *GpuStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectGpuStat)
+}
+
+func (t *GpuStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "gpu_busy", DisplayName: "gpu%", IsCmdShow: true},
+		{Name: "gpu_freq", DisplayName: "gpu(MHz)", IsCmdShow: true},
+		{Name: "gpu_max_freq", DisplayName: "gpuMax(MHz)", IsCmdShow: false},
+		{Name: "gpu_src", DisplayName: "gpuSrc", IsCmdShow: false},
+	}
+}
+
+func readGpuFile(f *GpuFile, format string) string {
+	if f == nil {
+		return ""
+	}
+	val, ok := f.Read()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(format, val)
+}
+
+func (t *GpuStatPlugin) collectGpuStat() {
+	if t.source == nil {
+		return
+	}
+	t.busy = readGpuFile(t.source.Busy, "%.1f")
+	t.curFreq = readGpuFile(t.source.CurFreq, "%.0f")
+	t.maxFreq = readGpuFile(t.source.MaxFreq, "%.0f")
+}
+
+func (t *GpuStatPlugin) GetData() map[string]string {
+	source := "none"
+	if t.source != nil {
+		source = t.source.Name
+	}
+	return map[string]string{
+		"gpu_busy":     t.busy,
+		"gpu_freq":     t.curFreq,
+		"gpu_max_freq": t.maxFreq,
+		"gpu_src":      source,
+	}
+}
@@ -0,0 +1,88 @@
+package plugins
+
+import (
+	"testing"
+
+	"romstat/stat/utils"
+)
+
+func TestDiscoverGpuSource(t *testing.T) {
+	cases := []struct {
+		name    string
+		files   map[string]string
+		source  string
+		busy    string
+		curFreq string
+		maxFreq string
+	}{
+		{
+			name: "adreno",
+			files: map[string]string{
+				"sys/class/kgsl/kgsl-3d0/gpubusy":    "  250000  1000000\n",
+				"sys/class/kgsl/kgsl-3d0/gpuclk":     "585000000\n",
+				"sys/class/kgsl/kgsl-3d0/max_gpuclk": "840000000\n",
+			},
+			source: "adreno", busy: "25.0", curFreq: "585", maxFreq: "840",
+		},
+		{
+			name: "adreno with busy percentage",
+			files: map[string]string{
+				"sys/class/kgsl/kgsl-3d0/gpu_busy_percentage": "37 %\n",
+				"sys/class/kgsl/kgsl-3d0/gpubusy":             "0 0\n",
+				"sys/class/kgsl/kgsl-3d0/devfreq/cur_freq":    "305000000\n",
+			},
+			source: "adreno", busy: "37.0", curFreq: "305", maxFreq: "",
+		},
+		{
+			name: "mali with devfreq",
+			files: map[string]string{
+				"sys/class/misc/mali0/device/utilization":                    "61\n",
+				"sys/class/misc/mali0/device/devfreq/13000000.mali/cur_freq": "572000000\n",
+				"sys/class/misc/mali0/device/devfreq/13000000.mali/max_freq": "848000000\n",
+			},
+			source: "mali", busy: "61.0", curFreq: "572", maxFreq: "848",
+		},
+		{
+			name: "samsung mali",
+			files: map[string]string{
+				"sys/kernel/gpu/gpu_busy":      "12%\n",
+				"sys/kernel/gpu/gpu_clock":     "260\n",
+				"sys/kernel/gpu/gpu_max_clock": "897\n",
+			},
+			source: "mali", busy: "12.0", curFreq: "260", maxFreq: "897",
+		},
+		{
+			name: "generic devfreq",
+			files: map[string]string{
+				"sys/class/devfreq/ddr/cur_freq":          "1866000000\n",
+				"sys/class/devfreq/fb000000.gpu/load":     "42@400000000Hz\n",
+				"sys/class/devfreq/fb000000.gpu/cur_freq": "400000000\n",
+				"sys/class/devfreq/fb000000.gpu/max_freq": "800000000\n",
+			},
+			source: "devfreq(fb000000.gpu)", busy: "42.0", curFreq: "400", maxFreq: "800",
+		},
+		{
+			name: "unknown soc",
+			files: map[string]string{
+				"sys/class/devfreq/ddr/cur_freq": "1866000000\n",
+			},
+			source: "none", busy: "", curFreq: "", maxFreq: "",
+		},
+	}
+	for _, c := range cases {
+		root := t.TempDir()
+		for name, content := range c.files {
+			writeFakeFile(t, root, name, content)
+		}
+		plugin := &GpuStatPlugin{sysRoot: root, debugLog: utils.NewDebugLogger()}
+		plugin.Open()
+		plugin.collectGpuStat()
+		ret := plugin.GetData()
+		expect := map[string]string{"gpu_src": c.source, "gpu_busy": c.busy, "gpu_freq": c.curFreq, "gpu_max_freq": c.maxFreq}
+		for k, v := range expect {
+			if ret[k] != v {
+				t.Errorf("ERROR: %s: %s=%s, expect %s", c.name, k, ret[k], v)
+			}
+		}
+	}
+}
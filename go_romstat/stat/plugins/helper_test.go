@@ -0,0 +1,29 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"romstat/stat/data"
+)
+
+// writeFakeFile writes a file of the fake procfs or sysfs under root
+func writeFakeFile(t *testing.T, root string, name string, content string) {
+	filename := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setUnresolvedPackage monitors a glob of packages none of which has been in foreground
+func setUnresolvedPackage(t *testing.T) {
+	params := data.GetCmdParameters()
+	pkgName := params.PkgName
+	params.PkgName = "com.haima.*"
+	params.SetForegroundPkgName("")
+	t.Cleanup(func() { params.PkgName = pkgName })
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+type DiskStat struct {
+	SectorsRead    uint64
+	SectorsWritten uint64
+	IoTicks        uint64 //milliseconds spent doing I/Os
+}
+
+// ParseDiskstats parses /proc/diskstats, the key is the device name
+func ParseDiskstats(content string) map[string]*DiskStat {
+	ret := make(map[string]*DiskStat)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 14 {
+			continue
+		}
+		sectorsRead, _ := strconv.ParseUint(fields[5], 10, 64)
+		sectorsWritten, _ := strconv.ParseUint(fields[9], 10, 64)
+		ioTicks, _ := strconv.ParseUint(fields[12], 10, 64)
+		ret[fields[2]] = &DiskStat{SectorsRead: sectorsRead, SectorsWritten: sectorsWritten, IoTicks: ioTicks}
+	}
+	return ret
+}
+
+// isPhysicalDisk checks whether the block device is a disk, the partitions and the virtual devices are skipped
+func isPhysicalDisk(sysRoot string, name string) bool {
+	for _, prefix := range []string{"loop", "ram", "zram", "dm-", "md"} {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return utils.CheckFileIsExist(filepath.Join(sysRoot, "sys/block", name))
+}
+
+type IoStatPlugin struct {
+	sysRoot string //root of the sysfs and procfs, '/' for the device
+
+	lastTimestamp time.Time
+	lastAppIo     map[int32]map[string]int64 //io counters of every process of the target package
+	lastDiskStats map[string]*DiskStat
+	lastCpuTimes  *CpuTimes
+
+	appRead   float64 //bytes per second
+	appWrite  float64
+	appSyscr  float64 //syscalls per second
+	appSyscw  float64
+	diskRead  float64 //bytes per second
+	diskWrite float64
+	diskUtil  float64 //percent of the busiest disk
+	ioWait    float64 //percent of all cpu time
+}
+
+func (t *IoStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	return true
+}
+
+func (t *IoStatPlugin) Close() {
+}
+
+func (t *IoStatPlugin) Run() {
+	t.collectIoStat()
+	go utils.SetTimer(1, t.collectIoStat)
+}
+
+func (t *IoStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "app_read", DisplayName: "appR(KB)", IsCmdShow: true},
+		{Name: "app_write", DisplayName: "appW(KB)", IsCmdShow: true},
+		{Name: "app_syscr", DisplayName: "syscr/s", IsCmdShow: false},
+		{Name: "app_syscw", DisplayName: "syscw/s", IsCmdShow: false},
+		{Name: "disk_read", DisplayName: "diskR(KB)", IsCmdShow: false},
+		{Name: "disk_write", DisplayName: "diskW(KB)", IsCmdShow: false},
+		{Name: "disk_util", DisplayName: "disk%", IsCmdShow: true},
+		{Name: "iowait", DisplayName: "iowait%", IsCmdShow: true},
+	}
+}
+
+func (t *IoStatPlugin) collectIoStat() {
+	t.update(data.GetCmdParameters().GetPids(), time.Now())
+}
+
+// update computes the rates of the interval, the counters which are reset or wrapped are dropped
+func (t *IoStatPlugin) update(pids []int32, now time.Time) {
+	elapsed := now.Sub(t.lastTimestamp).Seconds()
+	isFirst := t.lastTimestamp.IsZero()
+	t.lastTimestamp = now
+
+	//I/O of all processes of the target package, /proc/<pid>/io is only readable for the same user or root,
+	//a new process is counted from the next interval
+	appIo := make(map[int32]map[string]int64)
+	t.appRead, t.appWrite, t.appSyscr, t.appSyscw = 0, 0, 0, 0
+	for _, pid := range pids {
+		current := utils.ParseProcKeyValue(utils.ReadFileString(filepath.Join(t.sysRoot, "proc", strconv.Itoa(int(pid)), "io")))
+		if len(current) == 0 {
+			continue
+		}
+		appIo[pid] = current
+		last, ok := t.lastAppIo[pid]
+		if isFirst || !ok {
+			continue
+		}
+		t.appRead += float64(counterDelta(current["read_bytes"], last["read_bytes"])) / elapsed
+		t.appWrite += float64(counterDelta(current["write_bytes"], last["write_bytes"])) / elapsed
+		t.appSyscr += float64(counterDelta(current["syscr"], last["syscr"])) / elapsed
+		t.appSyscw += float64(counterDelta(current["syscw"], last["syscw"])) / elapsed
+	}
+	t.lastAppIo = appIo
+
+	//throughput and utilization of the block devices
+	diskStats := ParseDiskstats(utils.ReadFileString(filepath.Join(t.sysRoot, "proc/diskstats")))
+	t.diskRead, t.diskWrite, t.diskUtil = 0, 0, 0
+	if !isFirst {
+		for name, current := range diskStats {
+			last, ok := t.lastDiskStats[name]
+			if !ok || !isPhysicalDisk(t.sysRoot, name) {
+				continue
+			}
+			t.diskRead += counterRate(current.SectorsRead, last.SectorsRead, elapsed) * 512
+			t.diskWrite += counterRate(current.SectorsWritten, last.SectorsWritten, elapsed) * 512
+			if util := counterRate(current.IoTicks, last.IoTicks, elapsed) * 100 / 1000; util > t.diskUtil {
+				t.diskUtil = util
+			}
+		}
+	}
+	if t.diskUtil > 100 {
+		t.diskUtil = 100
+	}
+	t.lastDiskStats = diskStats
+
+	//iowait share of all cpu time
+	cpuTimes, ok := ParseProcStat(utils.ReadFileString(filepath.Join(t.sysRoot, "proc/stat")))["cpu"]
+	t.ioWait = 0
+	//iowait of the idle cores may go backwards
+	if ok && t.lastCpuTimes != nil && cpuTimes.Total > t.lastCpuTimes.Total && cpuTimes.IoWait >= t.lastCpuTimes.IoWait {
+		t.ioWait = float64(cpuTimes.IoWait-t.lastCpuTimes.IoWait) * 100 / float64(cpuTimes.Total-t.lastCpuTimes.Total)
+	}
+	t.lastCpuTimes = cpuTimes
+}
+
+func (t *IoStatPlugin) GetData() map[string]string {
+	ret := map[string]string{
+		"app_read":   fmt.Sprintf("%.1f", t.appRead/1024),
+		"app_write":  fmt.Sprintf("%.1f", t.appWrite/1024),
+		"app_syscr":  fmt.Sprintf("%.0f", t.appSyscr),
+		"app_syscw":  fmt.Sprintf("%.0f", t.appSyscw),
+		"disk_read":  fmt.Sprintf("%.1f", t.diskRead/1024),
+		"disk_write": fmt.Sprintf("%.1f", t.diskWrite/1024),
+		"disk_util":  fmt.Sprintf("%.1f", t.diskUtil),
+		"iowait":     fmt.Sprintf("%.1f", t.ioWait),
+	}
+	if !data.GetCmdParameters().IsPkgResolved() {
+		ret["app_read"], ret["app_write"], ret["app_syscr"], ret["app_syscw"] = "", "", "", ""
+	}
+	return ret
+}
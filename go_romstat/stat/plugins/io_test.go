@@ -0,0 +1,48 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIoStatCounterReset(t *testing.T) {
+	root := t.TempDir()
+	writeFakeFile(t, root, "sys/block/sda/stat", "")
+	writeFakeFile(t, root, "proc/1234/io", "rchar: 5000\nwchar: 6000\nsyscr: 100\nsyscw: 50\nread_bytes: 40960\nwrite_bytes: 81920\n")
+	writeFakeFile(t, root, "proc/diskstats", "   8       0 sda 1000 0 20000 500 800 0 40000 900 0 1200 1400 0 0 0 0\n"+
+		" 253       0 dm-0 1000 0 20000 500 800 0 40000 900 0 1200 1400 0 0 0 0\n")
+	writeFakeFile(t, root, "proc/stat", "cpu  100 0 100 800 10 0 0 0 0 0\n")
+
+	plugin := &IoStatPlugin{sysRoot: root}
+	now := time.Now()
+	plugin.update([]int32{1234}, now)
+
+	writeFakeFile(t, root, "proc/1234/io", "rchar: 9000\nwchar: 7000\nsyscr: 300\nsyscw: 60\nread_bytes: 143360\nwrite_bytes: 81920\n")
+	writeFakeFile(t, root, "proc/diskstats", "   8       0 sda 1100 0 22048 520 850 0 44096 950 0 1700 1500 0 0 0 0\n"+
+		" 253       0 dm-0 9000 0 90000 500 800 0 90000 900 0 9000 1400 0 0 0 0\n")
+	writeFakeFile(t, root, "proc/stat", "cpu  200 0 200 1580 30 0 0 0 0 0\n")
+	plugin.update([]int32{1234}, now.Add(time.Second))
+	expect := map[string]string{"app_read": "100.0", "app_write": "0.0", "app_syscr": "200", "app_syscw": "10",
+		"disk_read": "1024.0", "disk_write": "2048.0", "disk_util": "50.0", "iowait": "2.0"}
+	for name, value := range plugin.GetData() {
+		if value != expect[name] {
+			t.Errorf("ERROR: %s=%s, expect %s", name, value, expect[name])
+		}
+	}
+
+	//the process is replaced with the same pid and the disk counters are reset
+	writeFakeFile(t, root, "proc/1234/io", "rchar: 10\nwchar: 10\nsyscr: 1\nsyscw: 1\nread_bytes: 4096\nwrite_bytes: 0\n")
+	writeFakeFile(t, root, "proc/diskstats", "   8       0 sda 10 0 200 5 8 0 400 9 0 12 14 0 0 0 0\n")
+	writeFakeFile(t, root, "proc/stat", "cpu  300 0 300 2360 20 0 0 0 0 0\n")
+	plugin.update([]int32{1234}, now.Add(2*time.Second))
+	for name, value := range plugin.GetData() {
+		if value != "0.0" && value != "0" {
+			t.Errorf("ERROR: %s=%s, expect 0 after the counters are reset", name, value)
+		}
+	}
+
+	setUnresolvedPackage(t)
+	if ret := plugin.GetData(); ret["app_read"] != "" || ret["app_syscw"] != "" || ret["disk_read"] == "" {
+		t.Errorf("ERROR: data=%v, expect empty app columns before the package is resolved", ret)
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// the line of 'logcat -v epoch': 1697702400.123 12345 12399 I zygote64: message
+var rLogcatLine = regexp.MustCompile(`^\s*(\d+)\.(\d{3})\s+(\d+)\s+\d+\s+([VDIWEFA])\s+(.*?)\s*: (.*)$`)
+
+// the tags passed to the logcat filter
+var rLogcatTag = regexp.MustCompile(`^[\w.-]+$`)
+
+const logcatEventDetailLength = 256
+
+type LogcatLine struct {
+	TimeStamp int64 //milliseconds
+	Pid       int32
+	Level     string
+	Tag       string
+	Message   string
+}
+
+// ParseLogcatLine parses a line of 'logcat -v epoch', it returns nil for the separators like '--------- beginning of main'
+func ParseLogcatLine(line string) *LogcatLine {
+	sz := rLogcatLine.FindStringSubmatch(line)
+	if len(sz) < 7 {
+		return nil
+	}
+	seconds, _ := strconv.ParseInt(sz[1], 10, 64)
+	millis, _ := strconv.ParseInt(sz[2], 10, 64)
+	pid, _ := strconv.Atoi(sz[3])
+	return &LogcatLine{TimeStamp: seconds*1000 + millis, Pid: int32(pid), Level: sz[4], Tag: sz[5], Message: sz[6]}
+}
+
+// parseGaugeValue parses the captured number, a duration like 105.2ms is converted to milliseconds,
+// a list like the GC pauses '253us,130us' is summed up
+func parseGaugeValue(value string) (float64, bool) {
+	if strings.Contains(value, ",") {
+		sum := 0.0
+		for _, item := range strings.Split(value, ",") {
+			ret, ok := parseGaugeValue(item)
+			if !ok {
+				return 0, false
+			}
+			sum += ret
+		}
+		return sum, true
+	}
+	if ret, err := strconv.ParseFloat(value, 64); err == nil {
+		return ret, true
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return float64(duration.Nanoseconds()) / 1e6, true
+	}
+	return 0, false
+}
+
+type logcatRule struct {
+	*data.LogcatRule
+	re *regexp.Regexp
+}
+
+type logcatGauge struct {
+	last  float64
+	max   float64
+	sum   float64
+	count int
+}
+
+func (t *logcatGauge) add(value float64) {
+	if t.count == 0 || value > t.max {
+		t.max = value
+	}
+	t.last = value
+	t.sum += value
+	t.count += 1
+}
+
+func (t *logcatGauge) aggregate(aggregate string) float64 {
+	switch aggregate {
+	case data.AggregateMax:
+		return t.max
+	case data.AggregateAvg:
+		return t.sum / float64(t.count)
+	}
+	return t.last
+}
+
+// logcatReader is a long-lived logcat applying its rules
+type logcatReader struct {
+	rules  []*logcatRule
+	byUid  bool   //the lines are filtered by 'logcat --uid', otherwise by the pids of the target processes
+	filter string //the tag filter of the rules of all processes
+
+	args string //the arguments of the running logcat
+	cmd  *exec.Cmd
+}
+
+type LogcatStatPlugin struct {
+	EventRecorder
+
+	shell      *utils.AndroidShell
+	sdkVersion int64
+	rules      []*logcatRule
+	readers    []*logcatReader
+	startTime  int64 //milliseconds, the lines logged before are skipped
+
+	pids        map[int32]bool
+	pidsUpdated time.Time
+
+	lock     sync.Mutex
+	isClosed bool
+	counters map[string]int64        //counters of the current interval
+	gauges   map[string]*logcatGauge //gauges of the current interval
+	columns  map[string]string       //columns of the last interval
+}
+
+func (t *LogcatStatPlugin) Open() bool {
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	t.rules = make([]*logcatRule, 0)
+	for _, rule := range data.GetConfig().GetLogcatRules() {
+		//the rules are validated by data.LoadConfig
+		t.rules = append(t.rules, &logcatRule{LogcatRule: rule, re: regexp.MustCompile(rule.Pattern)})
+	}
+	if t.sdkVersion == 0 {
+		t.sdkVersion = t.shell.GetSdkVersion()
+	}
+	t.readers = t.newLogcatReaders(len(data.GetCmdParameters().GetPkgPatterns()) > 0 && t.sdkVersion >= 29)
+	t.startTime = time.Now().UnixMilli()
+	t.counters = make(map[string]int64)
+	t.gauges = make(map[string]*logcatGauge)
+	return true
+}
+
+func (t *LogcatStatPlugin) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.isClosed = true
+	for _, reader := range t.readers {
+		if reader.cmd != nil {
+			reader.cmd.Process.Kill()
+		}
+	}
+}
+
+func (t *LogcatStatPlugin) Run() {
+	for _, reader := range t.readers {
+		go t.runLogcat(reader)
+	}
+	go utils.SetTimer(1, t.checkReaders)
+	go utils.SetTimer(1, t.closeInterval)
+}
+
+func (t *LogcatStatPlugin) GetTypes() []*data.PluginType {
+	types := make([]*data.PluginType, 0)
+	for _, rule := range data.GetConfig().GetLogcatRules() {
+		//the event rules have no column
+		if rule.Type == data.LogcatCounter || rule.Type == data.LogcatGauge {
+			types = append(types, &data.PluginType{Name: rule.Name, DisplayName: rule.Name, IsCmdShow: true})
+		}
+	}
+	return types
+}
+
+// newLogcatReaders reads the lines of the app by 'logcat --uid' of android 10+, and the rules of all processes by another logcat
+// filtered by their tags. Otherwise one logcat reads the whole log, the lines are filtered by the pids of the target processes
+func (t *LogcatStatPlugin) newLogcatReaders(byUid bool) []*logcatReader {
+	if !byUid {
+		return []*logcatReader{{rules: t.rules}}
+	}
+	appReader := &logcatReader{rules: make([]*logcatRule, 0), byUid: true}
+	allReader := &logcatReader{rules: make([]*logcatRule, 0)}
+	tags := make([]string, 0)
+	for _, rule := range t.rules {
+		if !rule.AllProcesses {
+			appReader.rules = append(appReader.rules, rule)
+			continue
+		}
+		allReader.rules = append(allReader.rules, rule)
+		if tags != nil && rLogcatTag.MatchString(rule.Tag) {
+			tags = append(tags, rule.Tag+":V")
+		} else {
+			//a rule of any tag or a tag that cannot be passed to the shell
+			tags = nil
+		}
+	}
+	if tags != nil {
+		allReader.filter = " -s " + strings.Join(tags, " ")
+	}
+	if len(allReader.rules) == 0 {
+		return []*logcatReader{appReader}
+	}
+	return []*logcatReader{appReader, allReader}
+}
+
+// getLogcatArgs returns the arguments of the reader, "" if the uid of the app is not resolved yet
+func (t *LogcatStatPlugin) getLogcatArgs(reader *logcatReader) string {
+	args := "-v epoch -T 1"
+	if reader.byUid {
+		uid, ok := data.GetCmdParameters().GetUid()
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%s --uid %d", args, uid)
+	}
+	return args + reader.filter
+}
+
+// checkReaders restarts the logcat of the app when the uid is changed, e.g. another package given by globs is in foreground
+func (t *LogcatStatPlugin) checkReaders() {
+	for _, reader := range t.readers {
+		if !reader.byUid {
+			continue
+		}
+		args := t.getLogcatArgs(reader)
+		t.lock.Lock()
+		if reader.cmd != nil && reader.args != args {
+			reader.cmd.Process.Kill()
+			reader.cmd = nil
+		}
+		t.lock.Unlock()
+	}
+}
+
+func (t *LogcatStatPlugin) isReaderClosed() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.isClosed
+}
+
+// runLogcat reads logcat until the plugin is closed, logcat is restarted if it exits or the uid is changed.
+// The pids are not passed to 'logcat --pid', which loses the restarted process
+func (t *LogcatStatPlugin) runLogcat(reader *logcatReader) {
+	for !t.isReaderClosed() {
+		args := t.getLogcatArgs(reader)
+		if args == "" {
+			time.Sleep(time.Second)
+			continue
+		}
+		cmd, stdout, err := t.shell.StartShell("logcat " + args)
+		if err != nil {
+			utils.DebugLogger.Println("ERROR: logcat", err.Error())
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		t.lock.Lock()
+		if t.isClosed {
+			t.lock.Unlock()
+			cmd.Process.Kill()
+			cmd.Wait()
+			return
+		}
+		reader.cmd = cmd
+		reader.args = args
+		t.lock.Unlock()
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			t.processLine(reader, scanner.Text())
+		}
+		cmd.Wait()
+
+		t.lock.Lock()
+		isClosed := t.isClosed
+		isRestarted := reader.cmd != cmd
+		reader.cmd = nil
+		t.lock.Unlock()
+		if isClosed {
+			return
+		}
+		if !isRestarted {
+			utils.DebugLogger.Println("ERROR: logcat exited, restart it")
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (t *LogcatStatPlugin) isTargetPid(pid int32) bool {
+	if time.Since(t.pidsUpdated) >= time.Second {
+		t.pids = make(map[int32]bool)
+		for _, pid := range data.GetCmdParameters().GetPids() {
+			t.pids[pid] = true
+		}
+		t.pidsUpdated = time.Now()
+	}
+	return t.pids[pid]
+}
+
+// processLine applies the rules of the reader to the line of the monitored app, all lines are matched if no app is monitored
+func (t *LogcatStatPlugin) processLine(reader *logcatReader, text string) {
+	line := ParseLogcatLine(text)
+	if line == nil || line.TimeStamp < t.startTime {
+		return
+	}
+	pkgName := data.GetCmdParameters().GetMonitorPkgName()
+	isTarget := reader.byUid || len(data.GetCmdParameters().GetPkgPatterns()) == 0 || t.isTargetPid(line.Pid)
+	for _, rule := range reader.rules {
+		if !isTarget && !(rule.AllProcesses && pkgName != "" && strings.Contains(line.Message, pkgName)) {
+			continue
+		}
+		if rule.Tag != "" && rule.Tag != line.Tag {
+			continue
+		}
+		sz := rule.re.FindStringSubmatch(line.Message)
+		if sz == nil {
+			continue
+		}
+		switch rule.Type {
+		case data.LogcatEvent:
+			detail := line.Tag + ": " + line.Message
+			if len(detail) > logcatEventDetailLength {
+				detail = detail[:logcatEventDetailLength]
+			}
+			t.RecordEvent(rule.Name, detail)
+		case data.LogcatCounter:
+			t.lock.Lock()
+			t.counters[rule.Name] += 1
+			t.lock.Unlock()
+		case data.LogcatGauge:
+			value, ok := parseGaugeValue(sz[1])
+			if !ok {
+				continue
+			}
+			t.lock.Lock()
+			if t.gauges[rule.Name] == nil {
+				t.gauges[rule.Name] = new(logcatGauge)
+			}
+			t.gauges[rule.Name].add(value)
+			t.lock.Unlock()
+		}
+	}
+}
+
+// closeInterval reports the counters and gauges of the interval and starts a new one
+func (t *LogcatStatPlugin) closeInterval() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := make(map[string]string)
+	isResolved := data.GetCmdParameters().IsPkgResolved()
+	for _, rule := range t.rules {
+		if !isResolved {
+			ret[rule.Name] = ""
+			continue
+		}
+		switch rule.Type {
+		case data.LogcatCounter:
+			ret[rule.Name] = strconv.FormatInt(t.counters[rule.Name], 10)
+		case data.LogcatGauge:
+			ret[rule.Name] = ""
+			if gauge := t.gauges[rule.Name]; gauge != nil {
+				ret[rule.Name] = strconv.FormatFloat(math.Round(gauge.aggregate(rule.Aggregate)*100)/100, 'f', -1, 64)
+			}
+		}
+	}
+	t.counters = make(map[string]int64)
+	t.gauges = make(map[string]*logcatGauge)
+	t.columns = ret
+}
+
+func (t *LogcatStatPlugin) GetData() map[string]string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := make(map[string]string)
+	for _, rule := range t.rules {
+		if rule.Type != data.LogcatEvent {
+			ret[rule.Name] = t.columns[rule.Name]
+		}
+	}
+	return ret
+}
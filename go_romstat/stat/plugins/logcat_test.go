@@ -0,0 +1,134 @@
+package plugins
+
+import (
+	"math"
+	"testing"
+
+	"romstat/stat/data"
+)
+
+func TestParseLogcatLine(t *testing.T) {
+	line := ParseLogcatLine("1697702400.123 12345 12399 I e.cloudgame: Background concurrent copying GC freed 12345(5MB) AllocSpace objects, 49% free, 8MB/16MB, paused 253us,130us total 105.123ms")
+	if line == nil || line.TimeStamp != 1697702400123 || line.Pid != 12345 || line.Level != "I" || line.Tag != "e.cloudgame" {
+		t.Fatalf("ERROR: line=%+v", line)
+	}
+	if line = ParseLogcatLine("  1697702401.500  1234  1290 E ActivityManager: ANR in com.haima.cloudgame (com.haima.cloudgame/.GameActivity)"); line == nil || line.Tag != "ActivityManager" {
+		t.Errorf("ERROR: line=%+v, expect the tag ActivityManager", line)
+	}
+	if line = ParseLogcatLine("--------- beginning of main"); line != nil {
+		t.Errorf("ERROR: line=%+v, expect nil", *line)
+	}
+	for value, expect := range map[string]float64{"58.5": 58.5, "253us": 0.253, "105.123ms": 105.123, "1.2s": 1200, "253us,130us": 0.383} {
+		if ret, ok := parseGaugeValue(value); !ok || math.Abs(ret-expect) > 1e-9 {
+			t.Errorf("ERROR: gauge %s=%f, expect %f", value, ret, expect)
+		}
+	}
+}
+
+func TestLogcatRules(t *testing.T) {
+	defer func() { data.GetConfig().LogcatRules = nil }()
+	data.GetConfig().LogcatRules = []*data.LogcatRule{
+		{Name: "decode_fps", Type: data.LogcatGauge, Tag: "HmStream", Pattern: `decode fps=(\d+(?:\.\d+)?)`, Aggregate: data.AggregateAvg},
+		{Name: "reconnect", Type: data.LogcatCounter, Tag: "HmStream", Pattern: `reconnect`},
+	}
+	plugin := &LogcatStatPlugin{sdkVersion: 28}
+	plugin.Open()
+	plugin.startTime = 0
+	for _, line := range []string{
+		"1697702400.100 12345 12399 I HmStream: decode fps=58 bitrate=8000",
+		"1697702400.600 12345 12399 I HmStream: decode fps=61 bitrate=8200",
+		"1697702400.700 12345 12400 W HmStream: reconnect to edge",
+		"1697702400.800 12345 12400 W OtherTag: reconnect to edge",
+		"1697702400.900 12345 12401 I e.cloudgame: Background concurrent copying GC freed 12345(5MB) AllocSpace objects, paused 253us,130us total 105.123ms",
+		"1697702400.950 12345 12401 I e.cloudgame: Explicit concurrent copying GC freed 22(1KB) AllocSpace objects, paused 1.5ms total 20ms",
+		"1697702401.000 12345 12345 E AndroidRuntime: FATAL EXCEPTION: main",
+	} {
+		plugin.processLine(plugin.readers[0], line)
+	}
+	plugin.closeInterval()
+	expect := map[string]string{"gc": "2", "gc_pause": "1.5", "decode_fps": "59.5", "reconnect": "1"}
+	ret := plugin.GetData()
+	if len(ret) != len(expect) {
+		t.Errorf("ERROR: data=%v, expect %v", ret, expect)
+	}
+	for name, value := range expect {
+		if ret[name] != value {
+			t.Errorf("ERROR: %s=%s, expect %s", name, ret[name], value)
+		}
+	}
+	events := plugin.GetEvents()
+	if len(events) != 1 || events[0].Name != "crash" || events[0].Detail != "AndroidRuntime: FATAL EXCEPTION: main" {
+		t.Errorf("ERROR: events=%v, expect the crash", events)
+	}
+
+	plugin.closeInterval()
+	if ret = plugin.GetData(); ret["gc"] != "0" || ret["decode_fps"] != "" {
+		t.Errorf("ERROR: data=%v, expect the empty interval", ret)
+	}
+
+	//all pauses of a GC are summed up
+	plugin.processLine(plugin.readers[0], "1697702401.900 12345 12401 I e.cloudgame: Background concurrent copying GC freed 12345(5MB) AllocSpace objects, paused 253us,130us total 105.123ms")
+	plugin.closeInterval()
+	if ret = plugin.GetData(); ret["gc_pause"] != "0.38" {
+		t.Errorf("ERROR: gc_pause=%s, expect 0.38", ret["gc_pause"])
+	}
+}
+
+func TestLogcatReadersByUid(t *testing.T) {
+	params := data.GetCmdParameters()
+	defer func(pkgName string) { params.PkgName = pkgName }(params.PkgName)
+	params.PkgName = "com.haima.*"
+	params.SetForegroundPkgName("com.haima.cloudgame")
+	defer params.SetForegroundPkgName("")
+
+	plugin := &LogcatStatPlugin{sdkVersion: 28}
+	plugin.Open()
+	plugin.startTime = 0
+	readers := plugin.newLogcatReaders(true)
+	if len(readers) != 2 || !readers[0].byUid || readers[1].byUid {
+		t.Fatalf("ERROR: readers=%d, expect the app reader and the reader of all processes", len(readers))
+	}
+	if len(readers[1].rules) != 1 || readers[1].rules[0].Name != "anr" || readers[1].filter != " -s ActivityManager:V" {
+		t.Errorf("ERROR: rules of all processes=%d filter=%q, expect anr of ActivityManager", len(readers[1].rules), readers[1].filter)
+	}
+	for _, rule := range readers[0].rules {
+		if rule.AllProcesses {
+			t.Errorf("ERROR: the app reader applies the rule %s of all processes", rule.Name)
+		}
+	}
+	if args := plugin.getLogcatArgs(readers[1]); args != "-v epoch -T 1 -s ActivityManager:V" {
+		t.Errorf("ERROR: args=%s", args)
+	}
+
+	//the lines of the app reader are not filtered by the pids
+	plugin.processLine(readers[0], "1697702400.900 12345 12401 I e.cloudgame: Background concurrent copying GC freed 12345(5MB) AllocSpace objects, paused 253us total 105.123ms")
+	plugin.processLine(readers[1], "1697702401.000 1234 1290 E ActivityManager: ANR in com.haima.cloudgame (com.haima.cloudgame/.GameActivity)")
+	plugin.processLine(readers[1], "1697702401.100 1234 1290 E ActivityManager: ANR in com.other.app (com.other.app/.MainActivity)")
+	plugin.closeInterval()
+	if ret := plugin.GetData(); ret["gc"] != "1" || ret["gc_pause"] != "0.25" {
+		t.Errorf("ERROR: data=%v, expect the gc of the app", ret)
+	}
+	if events := plugin.GetEvents(); len(events) != 1 || events[0].Name != "anr" {
+		t.Errorf("ERROR: events=%v, expect the anr of the app", events)
+	}
+}
+
+func TestLogcatUnresolvedPackage(t *testing.T) {
+	params := data.GetCmdParameters()
+	defer func(pkgName string) { params.PkgName = pkgName }(params.PkgName)
+	params.PkgName = "com.haima.*"
+	params.SetForegroundPkgName("")
+
+	plugin := &LogcatStatPlugin{sdkVersion: 28}
+	plugin.Open()
+	plugin.startTime = 0
+	plugin.processLine(plugin.readers[0], "1697702400.900 12345 12401 I e.cloudgame: Background concurrent copying GC freed 12345(5MB) AllocSpace objects, paused 253us total 105.123ms")
+	plugin.processLine(plugin.readers[0], "1697702401.000 1234 1290 E ActivityManager: ANR in com.other.app (com.other.app/.MainActivity)")
+	plugin.closeInterval()
+	if ret := plugin.GetData(); ret["gc"] != "" || ret["gc_pause"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty before the package is resolved", ret)
+	}
+	if events := plugin.GetEvents(); len(events) != 0 {
+		t.Errorf("ERROR: events=%v, expect none before the package is resolved", events)
+	}
+}
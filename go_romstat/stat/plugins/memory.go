@@ -0,0 +1,285 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// Memory of the application, in KB, -1 if it is not available
+type AppMemInfo struct {
+	Pss        int64
+	Uss        int64
+	Rss        int64
+	SwapPss    int64
+	JavaHeap   int64
+	NativeHeap int64
+	Graphics   int64
+	GL         int64
+	EGL        int64
+}
+
+func NewAppMemInfo() *AppMemInfo {
+	return &AppMemInfo{Pss: -1, Uss: -1, Rss: -1, SwapPss: -1, JavaHeap: -1, NativeHeap: -1, Graphics: -1, GL: -1, EGL: -1}
+}
+
+var rMeminfoFields = []struct {
+	Regexp *regexp.Regexp
+	Field  func(t *AppMemInfo) *int64
+}{
+	{Regexp: regexp.MustCompile(`^Java Heap:\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.JavaHeap }},
+	{Regexp: regexp.MustCompile(`^Native Heap:\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.NativeHeap }},
+	{Regexp: regexp.MustCompile(`^Graphics:\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.Graphics }},
+	{Regexp: regexp.MustCompile(`^GL mtrack\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.GL }},
+	{Regexp: regexp.MustCompile(`^EGL mtrack\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.EGL }},
+	{Regexp: regexp.MustCompile(`TOTAL PSS:\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.Pss }},
+	{Regexp: regexp.MustCompile(`TOTAL RSS:\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.Rss }},
+	{Regexp: regexp.MustCompile(`TOTAL SWAP PSS:\s+(\d+)`), Field: func(t *AppMemInfo) *int64 { return &t.SwapPss }},
+}
+
+// the TOTAL row of the table, the columns are Pss Total, Private Dirty and Private Clean in all versions
+var rMeminfoTotalRow = regexp.MustCompile(`^TOTAL\s+(\d+)\s+(\d+)\s+(\d+)`)
+
+// ParseDumpsysMeminfo parses the output of 'dumpsys meminfo <pkg>', the values are in KB,
+// USS is the private dirty and clean memory of the TOTAL row
+func ParseDumpsysMeminfo(output string) *AppMemInfo {
+	ret := NewAppMemInfo()
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if sz := rMeminfoTotalRow.FindStringSubmatch(line); len(sz) > 3 && ret.Uss < 0 {
+			privateDirty, _ := strconv.ParseInt(sz[2], 10, 64)
+			privateClean, _ := strconv.ParseInt(sz[3], 10, 64)
+			ret.Uss = privateDirty + privateClean
+		}
+		for _, v := range rMeminfoFields {
+			field := v.Field(ret)
+			if *field >= 0 {
+				continue
+			}
+			if sz := v.Regexp.FindStringSubmatch(line); len(sz) > 1 {
+				*field, _ = strconv.ParseInt(sz[1], 10, 64)
+			}
+		}
+	}
+	return ret
+}
+
+// ParseSmapsRollup parses /proc/<pid>/smaps_rollup, the values are in KB
+func ParseSmapsRollup(content string) *AppMemInfo {
+	ret := NewAppMemInfo()
+	values := utils.ParseProcKeyValue(content)
+	if pss, ok := values["Pss"]; ok {
+		ret.Pss = pss
+		ret.Rss = values["Rss"]
+		ret.Uss = values["Private_Clean"] + values["Private_Dirty"]
+		ret.SwapPss = values["SwapPss"]
+	}
+	return ret
+}
+
+func (t *AppMemInfo) fields(other *AppMemInfo) []struct{ dst, src *int64 } {
+	return []struct{ dst, src *int64 }{
+		{&t.Pss, &other.Pss}, {&t.Uss, &other.Uss}, {&t.Rss, &other.Rss}, {&t.SwapPss, &other.SwapPss},
+		{&t.JavaHeap, &other.JavaHeap}, {&t.NativeHeap, &other.NativeHeap},
+		{&t.Graphics, &other.Graphics}, {&t.GL, &other.GL}, {&t.EGL, &other.EGL},
+	}
+}
+
+// merge fills the unavailable values with the other memory information
+func (t *AppMemInfo) merge(other *AppMemInfo) {
+	for _, v := range t.fields(other) {
+		if *v.dst < 0 {
+			*v.dst = *v.src
+		}
+	}
+}
+
+// add sums the memory information of another process, a value stays unavailable if no process has it
+func (t *AppMemInfo) add(other *AppMemInfo) {
+	for _, v := range t.fields(other) {
+		if *v.src < 0 {
+			continue
+		}
+		if *v.dst < 0 {
+			*v.dst = 0
+		}
+		*v.dst += *v.src
+	}
+}
+
+type MemoryStatPlugin struct {
+	sysRoot string //root of the sysfs and procfs, '/' for the device
+	shell   *utils.AndroidShell
+
+	appMemInfo     *AppMemInfo
+	meminfoDumpsys map[int32]*AppMemInfo //the last 'dumpsys meminfo' result of every process, refreshed at a slower cadence
+	meminfoUpdated time.Time
+	memAvailable   int64 //KB
+	zramUsed       int64 //KB
+
+	sessionStart  float64         //epoch seconds of the session start
+	lastKillEpoch float64         //epoch seconds of the last counted low memory kill
+	lastKillLines map[string]bool //the counted lines logged at lastKillEpoch, the kills share the millisecond
+	lmkKills      int
+	lmkUpdated    time.Time
+}
+
+func (t *MemoryStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	t.appMemInfo = NewAppMemInfo()
+	t.meminfoDumpsys = make(map[int32]*AppMemInfo)
+	t.sessionStart = float64(time.Now().UnixMilli()) / 1000
+	t.lastKillEpoch, t.lastKillLines = t.sessionStart, make(map[string]bool)
+	return true
+}
+
+func (t *MemoryStatPlugin) Close() {
+}
+
+func (t *MemoryStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectMemoryStat)
+}
+
+func (t *MemoryStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "pss", DisplayName: "pss(MB)", IsCmdShow: true},
+		{Name: "uss", DisplayName: "uss(MB)", IsCmdShow: false},
+		{Name: "rss", DisplayName: "rss(MB)", IsCmdShow: false},
+		{Name: "swap_pss", DisplayName: "swapPss(MB)", IsCmdShow: false},
+		{Name: "java_heap", DisplayName: "java(MB)", IsCmdShow: false},
+		{Name: "native_heap", DisplayName: "native(MB)", IsCmdShow: false},
+		{Name: "graphics", DisplayName: "graphics(MB)", IsCmdShow: false},
+		{Name: "gl", DisplayName: "gl(MB)", IsCmdShow: false},
+		{Name: "egl", DisplayName: "egl(MB)", IsCmdShow: false},
+		{Name: "mem_available", DisplayName: "avail(MB)", IsCmdShow: true},
+		{Name: "zram_used", DisplayName: "zram(MB)", IsCmdShow: false},
+		{Name: "lmk_kills", DisplayName: "lmk", IsCmdShow: true},
+	}
+}
+
+// getZramUsed returns the memory used by zram in KB, the swap usage is used if zram is not available
+func (t *MemoryStatPlugin) getZramUsed(meminfo map[string]int64) int64 {
+	zramPaths, _ := filepath.Glob(filepath.Join(t.sysRoot, "sys/block/zram*"))
+	var zramUsed int64
+	var found bool
+	for _, zramPath := range zramPaths {
+		//mm_stat: orig_data_size compr_data_size mem_used_total ...
+		fields := strings.Fields(utils.ReadFileString(filepath.Join(zramPath, "mm_stat")))
+		if len(fields) < 3 {
+			continue
+		}
+		memUsed, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		zramUsed += memUsed / 1024
+		found = true
+	}
+	if !found {
+		return meminfo["SwapTotal"] - meminfo["SwapFree"]
+	}
+	return zramUsed
+}
+
+// countLowMemoryKills counts the kills of lmkd since the session start,
+// lmkd logs 'killinfo' into the events buffer since android 11 and 'lowmemorykiller' into the main buffer before
+func (t *MemoryStatPlugin) countLowMemoryKills() {
+	t.addLowMemoryKills(t.shell.RunShell("logcat -b events -b main -d -v epoch -s killinfo:I lowmemorykiller:I"))
+}
+
+// addLowMemoryKills counts the kills logged after the last counted one, the lines logged in the same
+// millisecond as the last counted kill are deduplicated by the whole line
+func (t *MemoryStatPlugin) addLowMemoryKills(output string) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		epoch, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || epoch < t.lastKillEpoch || (epoch == t.lastKillEpoch && t.lastKillLines[line]) {
+			continue
+		}
+		if !strings.Contains(line, "killinfo") && !strings.Contains(line, "Kill") {
+			continue
+		}
+		if epoch > t.lastKillEpoch {
+			t.lastKillEpoch, t.lastKillLines = epoch, make(map[string]bool)
+		}
+		t.lmkKills += 1
+		t.lastKillLines[line] = true
+	}
+}
+
+func (t *MemoryStatPlugin) collectMemoryStat() {
+	meminfo := utils.ParseProcKeyValue(utils.ReadFileString(filepath.Join(t.sysRoot, "proc/meminfo")))
+	t.memAvailable = meminfo["MemAvailable"]
+	t.zramUsed = t.getZramUsed(meminfo)
+
+	if time.Since(t.lmkUpdated) >= 5*time.Second {
+		t.lmkUpdated = time.Now()
+		t.countLowMemoryKills()
+	}
+
+	//memory of all processes of the target package, smaps_rollup is only readable for root on most devices,
+	//dumpsys meminfo is used for the others
+	pids := data.GetCmdParameters().GetPids()
+	if time.Since(t.meminfoUpdated) >= 5*time.Second {
+		t.meminfoUpdated = time.Now()
+		meminfoDumpsys := make(map[int32]*AppMemInfo)
+		for _, pid := range pids {
+			meminfoDumpsys[pid] = ParseDumpsysMeminfo(t.shell.RunShell(fmt.Sprintf("dumpsys meminfo %d", pid)))
+		}
+		t.meminfoDumpsys = meminfoDumpsys
+	}
+	appMemInfo := NewAppMemInfo()
+	for _, pid := range pids {
+		processMemInfo := ParseSmapsRollup(utils.ReadFileString(filepath.Join(t.sysRoot, "proc", strconv.Itoa(int(pid)), "smaps_rollup")))
+		if meminfoDumpsys, ok := t.meminfoDumpsys[pid]; ok {
+			processMemInfo.merge(meminfoDumpsys)
+		}
+		appMemInfo.add(processMemInfo)
+	}
+	t.appMemInfo = appMemInfo
+}
+
+func formatMemoryMB(kb int64) string {
+	if kb < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", float64(kb)/1024)
+}
+
+func (t *MemoryStatPlugin) GetData() map[string]string {
+	appMemInfo := t.appMemInfo
+	if appMemInfo == nil || !data.GetCmdParameters().IsPkgResolved() {
+		appMemInfo = NewAppMemInfo()
+	}
+	return map[string]string{
+		"pss":           formatMemoryMB(appMemInfo.Pss),
+		"uss":           formatMemoryMB(appMemInfo.Uss),
+		"rss":           formatMemoryMB(appMemInfo.Rss),
+		"swap_pss":      formatMemoryMB(appMemInfo.SwapPss),
+		"java_heap":     formatMemoryMB(appMemInfo.JavaHeap),
+		"native_heap":   formatMemoryMB(appMemInfo.NativeHeap),
+		"graphics":      formatMemoryMB(appMemInfo.Graphics),
+		"gl":            formatMemoryMB(appMemInfo.GL),
+		"egl":           formatMemoryMB(appMemInfo.EGL),
+		"mem_available": formatMemoryMB(t.memAvailable),
+		"zram_used":     formatMemoryMB(t.zramUsed),
+		"lmk_kills":     strconv.Itoa(t.lmkKills),
+	}
+}
@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseDumpsysMeminfo(t *testing.T) {
+	output, err := os.ReadFile("testdata/meminfo_android12.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memInfo := ParseDumpsysMeminfo(string(output))
+	expect := AppMemInfo{Pss: 573852, Uss: 560732, Rss: 716912, SwapPss: 424, JavaHeap: 35080, NativeHeap: 182204, Graphics: 251492, GL: 130560, EGL: 28644}
+	if *memInfo != expect {
+		t.Errorf("ERROR: memInfo=%+v, expect %+v", *memInfo, expect)
+	}
+
+	//smaps_rollup values take precedence over dumpsys meminfo
+	rollup := ParseSmapsRollup(`00400000-7ffff0000000 ---p 00000000 00:00 0                          [rollup]
+Rss:              700000 kB
+Pss:              570000 kB
+Shared_Clean:      80000 kB
+Shared_Dirty:       2000 kB
+Private_Clean:     60000 kB
+Private_Dirty:    490000 kB
+Swap:               1000 kB
+SwapPss:             400 kB
+`)
+	rollup.merge(memInfo)
+	expect = AppMemInfo{Pss: 570000, Uss: 550000, Rss: 700000, SwapPss: 400, JavaHeap: 35080, NativeHeap: 182204, Graphics: 251492, GL: 130560, EGL: 28644}
+	if *rollup != expect {
+		t.Errorf("ERROR: rollup=%+v, expect %+v", *rollup, expect)
+	}
+}
+
+func TestMemoryUnresolvedPackage(t *testing.T) {
+	appMemInfo := NewAppMemInfo()
+	appMemInfo.Pss, appMemInfo.Uss = 204800, 102400
+	plugin := &MemoryStatPlugin{appMemInfo: appMemInfo, memAvailable: 1048576}
+	if ret := plugin.GetData(); ret["pss"] != "200.0" || ret["uss"] != "100.0" || ret["java_heap"] != "" {
+		t.Errorf("ERROR: data=%v, expect the app memory", ret)
+	}
+	setUnresolvedPackage(t)
+	if ret := plugin.GetData(); ret["pss"] != "" || ret["uss"] != "" || ret["mem_available"] != "1024.0" {
+		t.Errorf("ERROR: data=%v, expect empty app columns before the package is resolved", ret)
+	}
+}
+
+func TestLowMemoryKills(t *testing.T) {
+	plugin := &MemoryStatPlugin{}
+	plugin.Open()
+	plugin.lastKillEpoch = 1697702400.000
+	output := "--------- beginning of events\n" +
+		"1697702399.120   812   812 I killinfo: [10234,10187,900,201,9876,5,4,3,2,1,0]\n" +
+		"1697702401.512   812   812 I killinfo: [12345,10211,900,201,52340,5,4,3,2,1,0]\n" +
+		"1697702401.512   812   812 I killinfo: [12346,10212,905,201,41200,5,4,3,2,1,0]\n"
+	plugin.addLowMemoryKills(output)
+	if plugin.lmkKills != 2 {
+		t.Errorf("ERROR: kills=%d, expect 2 kills in the same millisecond", plugin.lmkKills)
+	}
+	//the next dump repeats the counted kills, the kill in the same millisecond logged later is counted
+	output += "1697702401.512   812   812 I killinfo: [12347,10213,905,201,30100,5,4,3,2,1,0]\n" +
+		"1697702403.004   812   812 I killinfo: [12400,10220,910,201,20480,5,4,3,2,1,0]\n"
+	plugin.addLowMemoryKills(output)
+	if plugin.lmkKills != 4 {
+		t.Errorf("ERROR: kills=%d, expect 4", plugin.lmkKills)
+	}
+	plugin.addLowMemoryKills(output)
+	if plugin.lmkKills != 4 {
+		t.Errorf("ERROR: kills=%d, expect the kills counted once", plugin.lmkKills)
+	}
+}
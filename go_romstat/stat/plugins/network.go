@@ -5,12 +5,12 @@ package plugins
 
 import (
 	"fmt"
-	"runtime"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/net"
-	"github.com/shirou/gopsutil/process"
 
 	"romstat/stat/data"
 	"romstat/stat/utils"
@@ -21,85 +21,289 @@ type NetData struct {
 	BytesRecv uint64
 }
 
+type trafficRate struct {
+	sendPerSec float64
+	recvPerSec float64
+}
+
+// uidTrafficSource reads the cumulative traffic counters of a uid at its own cadence
+type uidTrafficSource struct {
+	interval time.Duration
+	read     func(uid int32) map[string]*NetData //nil if the source is not available
+
+	unavailable  bool //the source is not polled anymore once it is not available
+	lastUpdated  time.Time
+	lastCounters map[string]*NetData
+	rates        map[string]*trafficRate
+}
+
+func (t *uidTrafficSource) reset() {
+	t.lastUpdated, t.lastCounters, t.rates = time.Time{}, nil, nil
+}
+
+func (t *uidTrafficSource) update(uid int32) {
+	if time.Since(t.lastUpdated) < t.interval {
+		return
+	}
+	counters := t.read(uid)
+	if counters == nil {
+		t.unavailable = true
+		t.reset()
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(t.lastUpdated).Seconds()
+	rates := make(map[string]*trafficRate)
+	for key, current := range counters {
+		last, ok := t.lastCounters[key]
+		if !ok {
+			continue
+		}
+		//the counters are reset when the stats are pruned or the map is recreated, the interval is dropped
+		rate := new(trafficRate)
+		if current.BytesSend >= last.BytesSend && current.BytesRecv >= last.BytesRecv {
+			rate.sendPerSec = float64(current.BytesSend-last.BytesSend) / elapsed
+			rate.recvPerSec = float64(current.BytesRecv-last.BytesRecv) / elapsed
+		}
+		rates[key] = rate
+	}
+	t.lastUpdated, t.lastCounters, t.rates = now, counters, rates
+}
+
+// InterfaceRate is the traffic of the counted interfaces per second
+type InterfaceRate struct {
+	SendPerSec        float64 //bytes
+	RecvPerSec        float64
+	PacketsSendPerSec float64
+	PacketsRecvPerSec float64
+	DropInPerSec      float64
+	DropOutPerSec     float64
+	ErrInPerSec       float64
+	ErrOutPerSec      float64
+}
+
+func (t *InterfaceRate) add(current net.IOCountersStat, last net.IOCountersStat, elapsed float64) {
+	t.SendPerSec += counterRate(current.BytesSent, last.BytesSent, elapsed)
+	t.RecvPerSec += counterRate(current.BytesRecv, last.BytesRecv, elapsed)
+	t.PacketsSendPerSec += counterRate(current.PacketsSent, last.PacketsSent, elapsed)
+	t.PacketsRecvPerSec += counterRate(current.PacketsRecv, last.PacketsRecv, elapsed)
+	t.DropInPerSec += counterRate(current.Dropin, last.Dropin, elapsed)
+	t.DropOutPerSec += counterRate(current.Dropout, last.Dropout, elapsed)
+	t.ErrInPerSec += counterRate(current.Errin, last.Errin, elapsed)
+	t.ErrOutPerSec += counterRate(current.Errout, last.Errout, elapsed)
+}
+
+var rInterfaceColumnName = regexp.MustCompile(`[^0-9A-Za-z_]`)
+
+func interfaceColumnName(name string) string {
+	return "if_" + rInterfaceColumnName.ReplaceAllString(name, "_")
+}
+
 type NetworkStatPlugin struct {
 	netInfo         []net.IOCountersStat
 	lastTimestamp   int64
-	lastNetStatData map[int]*NetData
-	sendPerSec      float64
-	recvPerSec      float64
+	lastNetStatData map[string]net.IOCountersStat //keyed by the interface name
+	countedIfaces   string                        //interfaces counted in the last interval, logged when changed
+	totalRate       *InterfaceRate
+	ifaceRates      map[string]*InterfaceRate //rates of the interfaces reported in their own columns
+
+	procPath   string //root of the procfs, /proc
+	shell      *utils.AndroidShell
+	appUid     int32
+	appSources []*uidTrafficSource //sources of the per uid traffic, the former ones take precedence
 }
 
 func (t *NetworkStatPlugin) Open() bool {
+	if t.procPath == "" {
+		t.procPath = "/proc"
+	}
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	qtaguidPath := filepath.Join(t.procPath, "net/xt_qtaguid/stats")
+	if utils.CheckFileIsExist(qtaguidPath) {
+		//xt_qtaguid is replaced by eBPF since android 9 with kernel 4.9+
+		t.appSources = []*uidTrafficSource{{interval: time.Second, read: func(uid int32) map[string]*NetData {
+			return ParseQtaguidStats(utils.ReadFileString(qtaguidPath), uid)
+		}}}
+	} else {
+		//netstats is the fallback of the devices without the BPF map, its resolution is much coarser
+		t.appSources = []*uidTrafficSource{
+			{interval: 2 * time.Second, read: t.readTrafficControllerStats},
+			{interval: time.Minute, read: t.readNetstatsDetail},
+		}
+	}
 	return true
 }
 
+func (t *NetworkStatPlugin) readTrafficControllerStats(uid int32) map[string]*NetData {
+	counters, ok := ParseTrafficControllerUidStats(t.shell.RunShell("dumpsys connectivity trafficcontroller"), uid)
+	if !ok {
+		return nil
+	}
+	return counters
+}
+
+// readNetstatsDetail reads the uid stats of NetworkStatsService without polling it, 'dumpsys netstats --poll'
+// persists the stats of the device and is not run. The service polls the kernel stats by itself after
+// every 2MB of the device traffic or every 30 minutes, so the source is read once a minute, the rates are
+// averaged over a minute at least and they are 0 in the minutes the service does not poll
+func (t *NetworkStatPlugin) readNetstatsDetail(uid int32) map[string]*NetData {
+	return ParseNetstatsDetail(t.shell.RunShell("dumpsys netstats detail"), uid)
+}
+
 func (t *NetworkStatPlugin) Close() {
 }
 
 func (t *NetworkStatPlugin) Run() {
-	if t.lastNetStatData == nil {
-		t.lastNetStatData = make(map[int]*NetData)
-	}
+	t.lastNetStatData = make(map[string]net.IOCountersStat)
+	t.totalRate = new(InterfaceRate)
+	t.ifaceRates = make(map[string]*InterfaceRate)
 	t.netInfo, _ = net.IOCounters(true)
-	for idx, v := range t.netInfo {
-		t.lastNetStatData[idx] = &NetData{BytesSend: v.BytesSent, BytesRecv: v.BytesRecv}
+	for _, v := range t.netInfo {
+		t.lastNetStatData[v.Name] = v
 	}
 	t.lastTimestamp = time.Now().UnixNano()
 	go utils.SetTimer(1, t.goNetworkStatBySeconds)
+	go utils.SetTimer(1, t.collectAppTraffic)
 }
 
 func (t *NetworkStatPlugin) GetTypes() []*data.PluginType {
-	return []*data.PluginType{
+	types := []*data.PluginType{
 		{Name: "net_in", DisplayName: "in(KB)", IsCmdShow: true},
 		{Name: "net_out", DisplayName: "out(KB)", IsCmdShow: true},
+		{Name: "net_pkt_in", DisplayName: "inPkt/s", IsCmdShow: false},
+		{Name: "net_pkt_out", DisplayName: "outPkt/s", IsCmdShow: false},
+		{Name: "net_drop_in", DisplayName: "inDrop/s", IsCmdShow: false},
+		{Name: "net_drop_out", DisplayName: "outDrop/s", IsCmdShow: false},
+		{Name: "net_err_in", DisplayName: "inErr/s", IsCmdShow: false},
+		{Name: "net_err_out", DisplayName: "outErr/s", IsCmdShow: false},
+		{Name: "app_in", DisplayName: "appIn(KB)", IsCmdShow: true},
+		{Name: "app_out", DisplayName: "appOut(KB)", IsCmdShow: true},
+		{Name: "app_wifi_in", DisplayName: "wifiIn(KB)", IsCmdShow: false},
+		{Name: "app_wifi_out", DisplayName: "wifiOut(KB)", IsCmdShow: false},
+		{Name: "app_mobile_in", DisplayName: "mobileIn(KB)", IsCmdShow: false},
+		{Name: "app_mobile_out", DisplayName: "mobileOut(KB)", IsCmdShow: false},
+		{Name: "app_tcp_in", DisplayName: "tcpIn(KB)", IsCmdShow: false},
+		{Name: "app_tcp_out", DisplayName: "tcpOut(KB)", IsCmdShow: false},
+		{Name: "app_udp_in", DisplayName: "udpIn(KB)", IsCmdShow: false},
+		{Name: "app_udp_out", DisplayName: "udpOut(KB)", IsCmdShow: false},
+	}
+	for _, name := range data.GetConfig().Network.PerInterface {
+		column := interfaceColumnName(name)
+		types = append(types,
+			&data.PluginType{Name: column + "_in", DisplayName: name + "In(KB)", IsCmdShow: false},
+			&data.PluginType{Name: column + "_out", DisplayName: name + "Out(KB)", IsCmdShow: false},
+			&data.PluginType{Name: column + "_pkt_in", DisplayName: name + "InPkt/s", IsCmdShow: false},
+			&data.PluginType{Name: column + "_pkt_out", DisplayName: name + "OutPkt/s", IsCmdShow: false})
+	}
+	return types
+}
+
+// collectAppTraffic collects the traffic of the target package uid, /proc/<pid>/net/dev is not used
+// since it holds the interface counters of the whole network namespace
+func (t *NetworkStatPlugin) collectAppTraffic() {
+	uid, ok := data.GetCmdParameters().GetUid()
+	if !ok || uid != t.appUid {
+		for _, source := range t.appSources {
+			source.reset()
+		}
+		t.appUid = uid
+	}
+	if !ok {
+		return
+	}
+	t.updateAppSources(uid)
+}
+
+// updateAppSources reads the first available source, the later ones are only the fallbacks
+func (t *NetworkStatPlugin) updateAppSources(uid int32) {
+	for _, source := range t.appSources {
+		if source.unavailable {
+			continue
+		}
+		source.update(uid)
+		if !source.unavailable {
+			break
+		}
 	}
 }
 
 func (t *NetworkStatPlugin) goNetworkStatBySeconds() {
 	oldTs := t.lastTimestamp
-	var sendDert, recvDert uint64
-	if pid := data.GetCmdParameters().GetPid(); pid != 0 {
-		//Network data related for given process
-		ps, _ := process.NewProcess(pid)
-		t.netInfo, _ = ps.NetIOCounters(true)
-	} else {
-		t.netInfo, _ = net.IOCounters(true)
-	}
-	for idx, v := range t.netInfo {
-		if _, ok := t.lastNetStatData[idx]; ok {
-			if runtime.GOOS != "windows" {
-				//BUGFIX:
-				//Only retain the rmnet and wlan, except the ccmni Network
-				//Avoid double counting on some mobile phones
-				if !strings.HasPrefix(v.Name, "rmnet_data") &&
-					!strings.HasPrefix(v.Name, "ccmni") &&
-					!strings.HasPrefix(v.Name, "wlan") {
-					continue
-				}
-				//BUGFIX: log collected network interface for debug information
-				utils.DebugLogger.Println("NETWORK", v.Name, !strings.HasPrefix(v.Name, "rmnet_data"),
-					!strings.HasPrefix(v.Name, "ccmni"),
-					!strings.HasPrefix(v.Name, "wlan"))
-			} else {
-				if strings.HasPrefix(v.Name, "Loopback Pseudo-Interface") {
-					continue
-				}
-			}
-			sendDert += v.BytesSent - t.lastNetStatData[idx].BytesSend
-			recvDert += v.BytesRecv - t.lastNetStatData[idx].BytesRecv
-			t.lastNetStatData[idx] = &NetData{BytesSend: v.BytesSent, BytesRecv: v.BytesRecv}
+	//Network data of the device, the traffic of the target package is collected by uid
+	t.netInfo, _ = net.IOCounters(true)
+	t.lastTimestamp = time.Now().UnixNano()
+	timeDert := float64(t.lastTimestamp-oldTs) / float64(time.Second)
+
+	networkConfig := data.GetConfig().Network
+	totalRate := new(InterfaceRate)
+	ifaceRates := make(map[string]*InterfaceRate)
+	countedIfaces := make([]string, 0)
+	lastNetStatData := t.lastNetStatData
+	t.lastNetStatData = make(map[string]net.IOCountersStat)
+	for _, v := range t.netInfo {
+		t.lastNetStatData[v.Name] = v
+		last, ok := lastNetStatData[v.Name]
+		if !ok {
+			continue
 		}
+		if utils.StringInSlice(v.Name, networkConfig.PerInterface) {
+			ifaceRate := new(InterfaceRate)
+			ifaceRate.add(v, last, timeDert)
+			ifaceRates[v.Name] = ifaceRate
+		}
+		if !networkConfig.MatchInterface(v.Name) {
+			continue
+		}
+		totalRate.add(v, last, timeDert)
+		countedIfaces = append(countedIfaces, v.Name)
 	}
-	t.lastTimestamp = time.Now().UnixNano()
+	t.totalRate, t.ifaceRates = totalRate, ifaceRates
 
-	timeDert := float64(t.lastTimestamp-oldTs) / float64(time.Second)
-	t.sendPerSec = float64(sendDert) / timeDert
-	t.recvPerSec = float64(recvDert) / timeDert
+	//BUGFIX: log collected network interfaces for debug information
+	if sz := strings.Join(countedIfaces, ","); sz != t.countedIfaces {
+		t.countedIfaces = sz
+		utils.DebugLogger.Println("NETWORK", "counted interfaces:", sz)
+	}
 }
 
 func (t *NetworkStatPlugin) GetData() map[string]string {
-	return map[string]string{
-		"net_in":  fmt.Sprintf("%.6f", t.recvPerSec/1024)[0:6],
-		"net_out": fmt.Sprintf("%.6f", t.sendPerSec/1024)[0:6],
+	totalRate := t.totalRate
+	ret := map[string]string{
+		"net_in":       fmt.Sprintf("%.6f", totalRate.RecvPerSec/1024)[0:6],
+		"net_out":      fmt.Sprintf("%.6f", totalRate.SendPerSec/1024)[0:6],
+		"net_pkt_in":   fmt.Sprintf("%.0f", totalRate.PacketsRecvPerSec),
+		"net_pkt_out":  fmt.Sprintf("%.0f", totalRate.PacketsSendPerSec),
+		"net_drop_in":  fmt.Sprintf("%.0f", totalRate.DropInPerSec),
+		"net_drop_out": fmt.Sprintf("%.0f", totalRate.DropOutPerSec),
+		"net_err_in":   fmt.Sprintf("%.0f", totalRate.ErrInPerSec),
+		"net_err_out":  fmt.Sprintf("%.0f", totalRate.ErrOutPerSec),
+	}
+	ifaceRates := t.ifaceRates
+	for _, name := range data.GetConfig().Network.PerInterface {
+		column := interfaceColumnName(name)
+		ret[column+"_in"], ret[column+"_out"], ret[column+"_pkt_in"], ret[column+"_pkt_out"] = "", "", "", ""
+		if ifaceRate, ok := ifaceRates[name]; ok {
+			ret[column+"_in"] = fmt.Sprintf("%.1f", ifaceRate.RecvPerSec/1024)
+			ret[column+"_out"] = fmt.Sprintf("%.1f", ifaceRate.SendPerSec/1024)
+			ret[column+"_pkt_in"] = fmt.Sprintf("%.0f", ifaceRate.PacketsRecvPerSec)
+			ret[column+"_pkt_out"] = fmt.Sprintf("%.0f", ifaceRate.PacketsSendPerSec)
+		}
+	}
+	appSources := t.appSources
+	if !data.GetCmdParameters().IsPkgResolved() {
+		appSources = nil
+	}
+	for _, key := range trafficKeys {
+		ret[key+"_in"], ret[key+"_out"] = "", ""
+		for _, source := range appSources {
+			if rate, ok := source.rates[key]; ok {
+				ret[key+"_in"] = fmt.Sprintf("%.1f", rate.recvPerSec/1024)
+				ret[key+"_out"] = fmt.Sprintf("%.1f", rate.sendPerSec/1024)
+				break
+			}
+		}
 	}
+	return ret
 }
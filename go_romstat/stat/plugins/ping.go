@@ -3,65 +3,234 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"romstat/stat/data"
 	"romstat/stat/utils"
 )
 
+// ProbeStat is the statistics of a probe round, the times are in milliseconds
+type ProbeStat struct {
+	Avg      float64
+	Min      float64
+	Max      float64
+	P95      float64
+	Jitter   float64 //mean difference of the consecutive round trip times
+	Loss     float64 //percent
+	Received int
+}
+
+// ComputeProbeStat computes the statistics of the round trip times of a probe round
+func ComputeProbeStat(stat *utils.PingStat) *ProbeStat {
+	ret := &ProbeStat{Received: len(stat.RssLst)}
+	if stat.SendPackages > 0 {
+		lost := stat.SendPackages - len(stat.RssLst)
+		if lost < 0 {
+			lost = 0
+		}
+		ret.Loss = float64(lost) * 100 / float64(stat.SendPackages)
+	}
+	if len(stat.RssLst) == 0 {
+		return ret
+	}
+	var total, jitter float64
+	for idx, rtt := range stat.RssLst {
+		total += rtt
+		if idx > 0 {
+			jitter += math.Abs(rtt - stat.RssLst[idx-1])
+		}
+	}
+	ret.Avg = total / float64(len(stat.RssLst))
+	if len(stat.RssLst) > 1 {
+		ret.Jitter = jitter / float64(len(stat.RssLst)-1)
+	}
+	sorted := append([]float64{}, stat.RssLst...)
+	sort.Float64s(sorted)
+	ret.Min, ret.Max = sorted[0], sorted[len(sorted)-1]
+	//nearest rank percentile
+	ret.P95 = sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+	return ret
+}
+
+var rProbeColumnName = regexp.MustCompile(`[^0-9a-z_]`)
+
+// probeColumnPrefix returns the column prefix of the probe target, the columns are not prefixed
+// if only one target is configured
+func probeColumnPrefix(target *data.ProbeTarget) string {
+	if len(data.GetConfig().GetProbeTargets()) <= 1 {
+		return ""
+	}
+	return rProbeColumnName.ReplaceAllString(strings.ToLower(target.Name), "_") + "_"
+}
+
+type probeState struct {
+	target *data.ProbeTarget
+	prefix string
+
+	lock    sync.Mutex //the round is written by the probe goroutine and read by GetData
+	stat    *ProbeStat //the last probe round, nil before the first round
+	dnsTime float64    //milliseconds, negative if the host is not resolved
+	ip      string     //the address answered the last round
+}
+
+// setRound saves the result of a round, the last answered address is kept if none is answered
+func (t *probeState) setRound(dnsTime float64, ip string, stat *ProbeStat) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.dnsTime, t.stat = dnsTime, stat
+	if ip != "" {
+		t.ip = ip
+	}
+}
+
+func (t *probeState) getRound() (float64, string, *ProbeStat) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.dnsTime, t.ip, t.stat
+}
+
 type NetworkPingPlugin struct {
-	currentStatLst []*utils.PingStat
+	probes []*probeState
 }
 
 func (t *NetworkPingPlugin) Open() bool {
-	t.currentStatLst = make([]*utils.PingStat, 0)
-	go t.runPingSecond(1)
+	t.probes = make([]*probeState, 0)
+	for _, target := range data.GetConfig().GetProbeTargets() {
+		t.probes = append(t.probes, &probeState{target: target, prefix: probeColumnPrefix(target), dnsTime: -1})
+	}
 	return true
 }
 
 func (t *NetworkPingPlugin) Close() {
 }
 
-func (t *NetworkPingPlugin) runPingSecond(count int) error {
-	stat, err := GetPingStat(count)
+// resolveHost resolves all addresses of the hostname and measures the dns resolution time, the ip address is not resolved
+func resolveHost(hostname string) ([]string, float64, error) {
+	if net.ParseIP(hostname) != nil {
+		return []string{hostname}, -1, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	startTime := time.Now()
+	addrs, err := utils.GetResolver().LookupHost(ctx, hostname)
 	if err != nil {
-		utils.DebugLogger.Println("ERROR: %s", err.Error())
-		return err
+		return nil, -1, err
+	}
+	if len(addrs) == 0 {
+		return nil, -1, fmt.Errorf("no address of %s", hostname)
 	}
+	return addrs, float64(time.Since(startTime).Microseconds()) / 1000, nil
+}
 
-	statLstSize := len(t.currentStatLst)
-	if statLstSize > 1 { //save the last seconds stat data
-		t.currentStatLst = t.currentStatLst[statLstSize-1 : statLstSize]
+// orderAddresses puts the address answered the last round first, then the ipv4 addresses, since the AAAA
+// record is often resolved on the networks without ipv6 route. The host is probed as is if it is not resolved
+func orderAddresses(addrs []string, lastIp string) []string {
+	if len(addrs) == 0 {
+		return []string{""}
 	}
-	t.currentStatLst = append(t.currentStatLst, stat)
-	return nil
+	ret := make([]string, len(addrs))
+	copy(ret, addrs)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if (ret[i] == lastIp) != (ret[j] == lastIp) {
+			return ret[i] == lastIp
+		}
+		isIpv4 := func(addr string) bool {
+			ip := net.ParseIP(addr)
+			return ip != nil && ip.To4() != nil
+		}
+		return isIpv4(ret[i]) && !isIpv4(ret[j])
+	})
+	return ret
 }
+
+// runProbe probes the target in rounds of about one second
+func (t *NetworkPingPlugin) runProbe(probe *probeState) {
+	interval := time.Second / time.Duration(probe.target.Count)
+	for {
+		startTime := time.Now()
+		addrs, dnsTime, err := resolveHost(probe.target.GetHostname())
+		if err != nil {
+			utils.DebugLogger.Println("ERROR: resolve", probe.target.Host, err.Error())
+		}
+
+		//the next address is tried in the same round if none of the probes is answered
+		var stat *utils.PingStat
+		var answeredIp string
+		_, lastIp, _ := probe.getRound()
+		for _, ip := range orderAddresses(addrs, lastIp) {
+			stat, err = RunProbeRound(probe.target, ip, interval)
+			if err != nil {
+				utils.DebugLogger.Println("ERROR: probe", probe.target.Host, ip, err.Error())
+				stat = &utils.PingStat{SendPackages: probe.target.Count}
+			}
+			if stat.RecvPackages > 0 {
+				answeredIp = ip
+				break
+			}
+		}
+		probe.setRound(dnsTime, answeredIp, ComputeProbeStat(stat))
+		if elapsed := time.Since(startTime); elapsed < time.Second {
+			time.Sleep(time.Second - elapsed)
+		}
+	}
+}
+
 func (t *NetworkPingPlugin) Run() {
+	for _, probe := range t.probes {
+		go t.runProbe(probe)
+	}
 }
+
 func (t *NetworkPingPlugin) GetTypes() []*data.PluginType {
-	return []*data.PluginType{
-		{Name: "rtt", DisplayName: "rtt(ms)", IsCmdShow: true},
-		{Name: "loss", DisplayName: "loss", IsCmdShow: true},
+	types := make([]*data.PluginType, 0)
+	for _, target := range data.GetConfig().GetProbeTargets() {
+		prefix, displayPrefix := probeColumnPrefix(target), ""
+		if prefix != "" {
+			displayPrefix = target.Name + ":"
+		}
+		types = append(types,
+			&data.PluginType{Name: prefix + "rtt", DisplayName: displayPrefix + "rtt(ms)", IsCmdShow: true},
+			&data.PluginType{Name: prefix + "rtt_min", DisplayName: displayPrefix + "min(ms)", IsCmdShow: false},
+			&data.PluginType{Name: prefix + "rtt_max", DisplayName: displayPrefix + "max(ms)", IsCmdShow: false},
+			&data.PluginType{Name: prefix + "rtt_p95", DisplayName: displayPrefix + "p95(ms)", IsCmdShow: false},
+			&data.PluginType{Name: prefix + "jitter", DisplayName: displayPrefix + "jitter(ms)", IsCmdShow: false},
+			&data.PluginType{Name: prefix + "loss", DisplayName: displayPrefix + "loss%", IsCmdShow: true},
+			&data.PluginType{Name: prefix + "dns", DisplayName: displayPrefix + "dns(ms)", IsCmdShow: false})
 	}
+	return types
 }
 
 func (t *NetworkPingPlugin) GetData() map[string]string {
-	go t.runPingSecond(5)
-	var avgRss, totalRss float64
-	if len(t.currentStatLst) == 0 {
-		return map[string]string{
-			"rtt":  "0.0",
-			"loss": "0",
+	ret := make(map[string]string)
+	for _, probe := range t.probes {
+		prefix := probe.prefix
+		for _, name := range []string{"rtt", "rtt_min", "rtt_max", "rtt_p95", "jitter", "loss", "dns"} {
+			ret[prefix+name] = ""
 		}
+		dnsTime, _, stat := probe.getRound()
+		if dnsTime >= 0 {
+			ret[prefix+"dns"] = fmt.Sprintf("%.1f", dnsTime)
+		}
+		if stat == nil {
+			continue
+		}
+		ret[prefix+"loss"] = fmt.Sprintf("%.1f", stat.Loss)
+		if stat.Received == 0 {
+			continue
+		}
+		ret[prefix+"rtt"] = fmt.Sprintf("%.1f", stat.Avg)
+		ret[prefix+"rtt_min"] = fmt.Sprintf("%.1f", stat.Min)
+		ret[prefix+"rtt_max"] = fmt.Sprintf("%.1f", stat.Max)
+		ret[prefix+"rtt_p95"] = fmt.Sprintf("%.1f", stat.P95)
+		ret[prefix+"jitter"] = fmt.Sprintf("%.1f", stat.Jitter)
 	}
-	currentStat := t.currentStatLst[0]
-	for _, rss := range currentStat.RssLst {
-		totalRss += rss
-	}
-	if len(currentStat.RssLst) > 0 {
-		avgRss = totalRss / float64(len(currentStat.RssLst))
-	}
-	return map[string]string{
-		"rtt":  fmt.Sprintf("%.1f", avgRss),
-		"loss": fmt.Sprintf("%d", currentStat.SendPackages-currentStat.RecvPackages),
-	}
+	return ret
 }
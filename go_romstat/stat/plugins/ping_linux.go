@@ -6,9 +6,80 @@
 
 package plugins
 
-import "romstat/stat/utils"
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-func GetPingStat(count int) (*utils.PingStat, error) {
+	"github.com/go-ping/ping"
+
+	"romstat/stat/utils"
+)
+
+const (
+	icmpDatagram = iota //unprivileged icmp socket, allowed by net.ipv4.ping_group_range
+	icmpRaw             //raw socket, needs root
+	icmpShell           //the ping command
+)
+
+// icmpMode is the way the echo requests are sent, it degrades when the socket is not permitted
+var icmpMode int32 = icmpDatagram
+
+// nextIcmpMode returns the mode to fall back on when the socket of the mode is not permitted
+func nextIcmpMode(mode int32) int32 {
+	if mode == icmpDatagram && os.Geteuid() == 0 {
+		return icmpRaw
+	}
+	return icmpShell
+}
+
+// isSocketDenied reports whether the icmp socket can not be opened in the mode
+func isSocketDenied(err error) bool {
+	return errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EPROTONOSUPPORT) || errors.Is(err, syscall.EAFNOSUPPORT)
+}
+
+// nativePing sends count echo requests to the ip at the interval in the process
+func nativePing(ip *net.IPAddr, count int, interval time.Duration, privileged bool) (*utils.PingStat, error) {
+	rtts := make([]time.Duration, count)
+	received := make([]bool, count)
+	pinger := ping.New(ip.String())
+	pinger.SetIPAddr(ip)
+	pinger.SetPrivileged(privileged)
+	pinger.SetLogger(ping.NoopLogger{})
+	pinger.Count = count
+	pinger.Interval = interval
+	pinger.Timeout = time.Duration(count)*interval + probeTimeout
+	pinger.RecordRtts = false
+	//the duplicated replies are not passed to OnRecv
+	pinger.OnRecv = func(p *ping.Packet) {
+		if p.Seq >= 0 && p.Seq < count {
+			rtts[p.Seq], received[p.Seq] = p.Rtt, true
+		}
+	}
+	if err := pinger.Run(); err != nil {
+		return nil, err
+	}
+	return newSeqPingStat(rtts, received), nil
+}
+
+// GetPingStat pings the host with the icmp socket, the ping command is the last fallback, it is also used
+// if the host is not resolved
+func GetPingStat(host string, count int, interval time.Duration) (*utils.PingStat, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		for mode := atomic.LoadInt32(&icmpMode); mode != icmpShell; mode = atomic.LoadInt32(&icmpMode) {
+			stat, err := nativePing(&net.IPAddr{IP: ip}, count, interval, mode == icmpRaw)
+			if err == nil || !isSocketDenied(err) {
+				return stat, err
+			}
+			next := nextIcmpMode(mode)
+			if atomic.CompareAndSwapInt32(&icmpMode, mode, next) {
+				utils.DebugLogger.Println("icmp socket denied, mode", mode, "->", next, err.Error())
+			}
+		}
+	}
 	shell := utils.NewAndroidShell()
-	return shell.GetPingStat("www.baidu.com", count)
+	return shell.GetPingStat(host, count, interval)
 }
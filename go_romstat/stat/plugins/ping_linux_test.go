@@ -0,0 +1,31 @@
+package plugins
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNativePing(t *testing.T) {
+	for _, privileged := range []bool{false, true} {
+		stat, err := nativePing(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}, 4, 20*time.Millisecond, privileged)
+		if err != nil {
+			if isSocketDenied(err) {
+				t.Logf("icmp socket privileged=%v is not permitted: %s", privileged, err.Error())
+				continue
+			}
+			t.Fatal(err)
+		}
+		if stat.SendPackages != 4 || stat.RecvPackages != 4 || len(stat.RssLst) != 4 {
+			t.Errorf("ERROR: privileged=%v sent=%d received=%d, expect 4/4", privileged, stat.SendPackages, stat.RecvPackages)
+		}
+	}
+}
+
+func TestSeqPingStat(t *testing.T) {
+	rtts := []time.Duration{10 * time.Millisecond, 0, 30 * time.Millisecond, 0}
+	stat := newSeqPingStat(rtts, []bool{true, false, true, false})
+	if stat.SendPackages != 4 || stat.RecvPackages != 2 || stat.RssLst[0] != 10 || stat.RssLst[1] != 30 {
+		t.Errorf("ERROR: stat=%+v, expect 2 of 4 in the sequence order", *stat)
+	}
+}
@@ -0,0 +1,95 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+func TestComputeProbeStat(t *testing.T) {
+	stat := ComputeProbeStat(&utils.PingStat{SendPackages: 10, RssLst: []float64{30, 32, 28, 35, 31, 90, 29, 30}})
+	expect := ProbeStat{Avg: 38.125, Min: 28, Max: 90, P95: 90, Jitter: 138.0 / 7, Loss: 20, Received: 8}
+	if *stat != expect {
+		t.Errorf("ERROR: stat=%+v, expect %+v", *stat, expect)
+	}
+	stat = ComputeProbeStat(&utils.PingStat{SendPackages: 5})
+	if stat.Loss != 100 || stat.Received != 0 {
+		t.Errorf("ERROR: stat=%+v, expect 100%% loss", *stat)
+	}
+}
+
+func TestProbeColumns(t *testing.T) {
+	plugin := new(NetworkPingPlugin)
+	if types := plugin.GetTypes(); len(types) != 7 || types[0].Name != "rtt" || types[5].Name != "loss" {
+		t.Errorf("ERROR: default columns %s %s, expect rtt and loss", types[0].Name, types[5].Name)
+	}
+
+	filename := filepath.Join(t.TempDir(), "romstat.json")
+	if err := os.WriteFile(filename, []byte(`{"probes": [{"name": "HK-Edge", "host": "10.0.0.1"}, {"host": "sg.example.com", "count": 10}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.LoadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { *data.GetConfig() = data.Config{} }()
+	plugin.Open()
+	//the rounds are saved by the probe goroutines while the data is read
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			plugin.probes[0].setRound(-1, "10.0.0.1", ComputeProbeStat(&utils.PingStat{SendPackages: 5, RssLst: []float64{10, 12, 11, 13, 14}}))
+			plugin.probes[1].setRound(12.34, "", nil)
+		}
+		close(done)
+	}()
+	for isDone := false; !isDone; {
+		select {
+		case <-done:
+			isDone = true
+		default:
+			plugin.GetData()
+		}
+	}
+	ret := plugin.GetData()
+	expect := map[string]string{
+		"hk_edge_rtt":            "12.0",
+		"hk_edge_rtt_p95":        "14.0",
+		"hk_edge_loss":           "0.0",
+		"hk_edge_dns":            "",
+		"sg_example_com_rtt":     "",
+		"sg_example_com_dns":     "12.3",
+		"sg_example_com_jitter":  "",
+		"sg_example_com_rtt_max": "",
+	}
+	for k, v := range expect {
+		if value, ok := ret[k]; !ok || value != v {
+			t.Errorf("ERROR: %s=%s, expect %s", k, value, v)
+		}
+	}
+	if types := plugin.GetTypes(); len(types) != 14 || types[7].DisplayName != "sg.example.com:rtt(ms)" {
+		t.Errorf("ERROR: %d columns, expect 14", len(types))
+	}
+}
+
+func TestOrderAddresses(t *testing.T) {
+	addrs := []string{"2001:db8::1", "203.0.113.7", "2001:db8::2", "203.0.113.8"}
+	cases := []struct {
+		lastIp string
+		expect []string
+	}{
+		{"", []string{"203.0.113.7", "203.0.113.8", "2001:db8::1", "2001:db8::2"}},
+		{"2001:db8::2", []string{"2001:db8::2", "203.0.113.7", "203.0.113.8", "2001:db8::1"}},
+	}
+	for _, v := range cases {
+		if ret := orderAddresses(addrs, v.lastIp); strings.Join(ret, ",") != strings.Join(v.expect, ",") {
+			t.Errorf("ERROR: last=%s addresses=%v, expect %v", v.lastIp, ret, v.expect)
+		}
+	}
+	if ret := orderAddresses(nil, ""); len(ret) != 1 || ret[0] != "" {
+		t.Errorf("ERROR: addresses=%v, expect the host probed as is", ret)
+	}
+}
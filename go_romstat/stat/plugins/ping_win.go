@@ -13,17 +13,17 @@ import (
 	"github.com/go-ping/ping"
 )
 
-func GetPingStat(count int) (*utils.PingStat, error) {
+func GetPingStat(host string, count int, interval time.Duration) (*utils.PingStat, error) {
 	stat := new(utils.PingStat)
 	stat.RssLst = make([]float64, 0)
-	pinger, err := ping.NewPinger("www.baidu.com")
+	pinger, err := ping.NewPinger(host)
 	if err != nil {
 		return nil, err
 	}
 	pinger.SetPrivileged(true)
 	pinger.Count = count
-	pinger.Interval = 200 * time.Millisecond
-	pinger.Timeout = 1 * time.Second
+	pinger.Interval = interval
+	pinger.Timeout = time.Duration(count)*interval + time.Second
 	pinger.OnRecv = func(p *ping.Packet) {
 		stat.RssLst = append(stat.RssLst, float64(p.Rtt.Abs().Seconds()*1000))
 	}
@@ -32,9 +32,8 @@ func GetPingStat(count int) (*utils.PingStat, error) {
 		stat.SendPackages = stats.PacketsSent
 	}
 
-	err = pinger.Run()
-	if err != nil {
-		panic(err)
+	if err = pinger.Run(); err != nil {
+		return nil, err
 	}
 	return stat, nil
 }
@@ -0,0 +1,152 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+const probeTimeout = time.Second
+
+// sendProbes sends count probes at the interval, the probes run concurrently so that a lost probe does not
+// delay the next one, the round trip times are kept in the sequence order
+func sendProbes(count int, interval time.Duration, probe func(seq int) (time.Duration, error)) *utils.PingStat {
+	rtts := make([]time.Duration, count)
+	received := make([]bool, count)
+	var wg sync.WaitGroup
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			time.Sleep(interval)
+		}
+		wg.Add(1)
+		go func(seq int) {
+			defer wg.Done()
+			if rtt, err := probe(seq); err == nil {
+				rtts[seq], received[seq] = rtt, true
+			}
+		}(seq)
+	}
+	wg.Wait()
+	return newSeqPingStat(rtts, received)
+}
+
+// newSeqPingStat builds the stat of a probe round from the round trip times indexed by the sequence,
+// the sequences not received are counted as the loss
+func newSeqPingStat(rtts []time.Duration, received []bool) *utils.PingStat {
+	stat := &utils.PingStat{SendPackages: len(rtts), RssLst: make([]float64, 0)}
+	for seq := range rtts {
+		if received[seq] {
+			stat.RssLst = append(stat.RssLst, float64(rtts[seq].Microseconds())/1000)
+		}
+	}
+	stat.RecvPackages = len(stat.RssLst)
+	return stat
+}
+
+// replaceHost replaces the host of the address with the resolved ip, the dns time is reported separately
+func replaceHost(address string, ip string) string {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil || ip == "" {
+		return address
+	}
+	return net.JoinHostPort(ip, port)
+}
+
+// probeTcp measures the tcp connect time
+func probeTcp(address string) (time.Duration, error) {
+	startTime := time.Now()
+	conn, err := net.DialTimeout("tcp", address, probeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(startTime)
+	conn.Close()
+	return rtt, nil
+}
+
+// probeHttp measures the time to first byte of a new connection, including the tcp and tls handshakes
+func probeHttp(url string, ip string) (time.Duration, error) {
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, replaceHost(address, ip))
+		},
+	}
+	defer transport.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*probeTimeout)
+	defer cancel()
+	var firstByteTime time.Time
+	trace := &httptrace.ClientTrace{GotFirstResponseByte: func() { firstByteTime = time.Now() }}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	startTime := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if firstByteTime.IsZero() {
+		return 0, fmt.Errorf("no response of %s", url)
+	}
+	return firstByteTime.Sub(startTime), nil
+}
+
+// probeUdp measures the round trip time of a datagram echoed by 'romstat udpecho'
+func probeUdp(address string, seq int) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", address, probeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	payload := []byte(fmt.Sprintf("romstat-probe %d %d", seq, time.Now().UnixNano()))
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+	startTime := time.Now()
+	if _, err = conn.Write(payload); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		//a late echo of the former probe is dropped by the payload check
+		if bytes.Equal(buf[:n], payload) {
+			return time.Since(startTime), nil
+		}
+	}
+}
+
+// RunProbeRound runs a probe round against the target, ip is the resolved address of the target host,
+// it is empty if the host is not resolved by romstat
+func RunProbeRound(target *data.ProbeTarget, ip string, interval time.Duration) (*utils.PingStat, error) {
+	switch target.Type {
+	case data.ProbeTcp:
+		address := replaceHost(target.Host, ip)
+		return sendProbes(target.Count, interval, func(int) (time.Duration, error) { return probeTcp(address) }), nil
+	case data.ProbeHttp:
+		return sendProbes(target.Count, interval, func(int) (time.Duration, error) { return probeHttp(target.Host, ip) }), nil
+	case data.ProbeUdp:
+		address := replaceHost(target.Host, ip)
+		return sendProbes(target.Count, interval, func(seq int) (time.Duration, error) { return probeUdp(address, seq) }), nil
+	}
+	address := ip
+	if address == "" {
+		address = target.Host
+	}
+	return GetPingStat(address, target.Count, interval)
+}
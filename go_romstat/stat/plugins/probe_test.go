@@ -0,0 +1,89 @@
+package plugins
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+func checkProbeRound(t *testing.T, target *data.ProbeTarget, received int, minRtt float64) {
+	t.Helper()
+	stat, err := RunProbeRound(target, "", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.SendPackages != target.Count || stat.RecvPackages != received || len(stat.RssLst) != received {
+		t.Errorf("ERROR: %s probe %s sent=%d received=%d, expect %d/%d", target.Type, target.Host, stat.SendPackages, stat.RecvPackages, received, target.Count)
+	}
+	for _, rtt := range stat.RssLst {
+		if rtt < minRtt || rtt > 1000 {
+			t.Errorf("ERROR: %s probe rtt=%.3f, expect >= %.1f", target.Type, rtt, minRtt)
+		}
+	}
+}
+
+func TestTcpProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	address := listener.Addr().String()
+	checkProbeRound(t, &data.ProbeTarget{Type: data.ProbeTcp, Host: address, Count: 3}, 3, 0)
+	listener.Close()
+	checkProbeRound(t, &data.ProbeTarget{Type: data.ProbeTcp, Host: address, Count: 3}, 0, 0)
+}
+
+func TestHttpProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	checkProbeRound(t, &data.ProbeTarget{Type: data.ProbeHttp, Host: server.URL + "/ping", Count: 2}, 2, 20)
+}
+
+func TestUdpProbe(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go utils.ServeUdpEcho(conn)
+	address := conn.LocalAddr().String()
+	checkProbeRound(t, &data.ProbeTarget{Type: data.ProbeUdp, Host: address, Count: 4}, 4, 0)
+	conn.Close()
+	checkProbeRound(t, &data.ProbeTarget{Type: data.ProbeUdp, Host: address, Count: 2}, 0, 0)
+}
+
+func TestProbeTargetHostname(t *testing.T) {
+	cases := []struct {
+		target   data.ProbeTarget
+		hostname string
+	}{
+		{data.ProbeTarget{Type: data.ProbeIcmp, Host: "edge.example.com"}, "edge.example.com"},
+		{data.ProbeTarget{Type: data.ProbeTcp, Host: "edge.example.com:443"}, "edge.example.com"},
+		{data.ProbeTarget{Type: data.ProbeUdp, Host: "[2001:db8::1]:7777"}, "2001:db8::1"},
+		{data.ProbeTarget{Type: data.ProbeHttp, Host: "https://edge.example.com:8443/health"}, "edge.example.com"},
+	}
+	for _, v := range cases {
+		if hostname := v.target.GetHostname(); hostname != v.hostname {
+			t.Errorf("ERROR: hostname=%s, expect %s", hostname, v.hostname)
+		}
+	}
+	if address := replaceHost("edge.example.com:443", "10.0.0.1"); address != "10.0.0.1:443" {
+		t.Errorf("ERROR: address=%s, expect 10.0.0.1:443", address)
+	}
+}
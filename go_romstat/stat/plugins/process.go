@@ -0,0 +1,114 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+type ProcessStatData struct {
+	Pid   int32
+	Name  string
+	Ticks uint64
+	Usage float64 //usage percent against all cores
+	Rss   int64   //KB
+}
+
+// ShortProcessName strips the package name of the sub processes, e.g. 'com.tencent.mm:push' to ':push',
+// and names the main process 'main', the processes of the other packages sharing the uid keep the full name
+func ShortProcessName(processName string, pkgName string) string {
+	if processName == pkgName {
+		return "main"
+	}
+	if data.IsPackageProcess(processName, pkgName) {
+		return strings.TrimPrefix(processName, pkgName)
+	}
+	return processName
+}
+
+type ProcessStatPlugin struct {
+	procPath string //root of the procfs, /proc
+
+	lastTotalTicks uint64
+	lastTicks      map[int32]uint64
+	processes      []*ProcessStatData
+}
+
+func (t *ProcessStatPlugin) Open() bool {
+	if t.procPath == "" {
+		t.procPath = "/proc"
+	}
+	t.lastTicks = make(map[int32]uint64)
+	return true
+}
+
+func (t *ProcessStatPlugin) Close() {
+}
+
+func (t *ProcessStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectProcessStat)
+}
+
+func (t *ProcessStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "procs", DisplayName: "procs", IsCmdShow: true},
+		{Name: "proc_detail", DisplayName: "procDetail", IsCmdShow: false},
+	}
+}
+
+func (t *ProcessStatPlugin) collectProcessStat() {
+	var totalTicks uint64
+	if cpuTimes, ok := ParseProcStat(utils.ReadFileString(filepath.Join(t.procPath, "stat")))["cpu"]; ok {
+		totalTicks = cpuTimes.Total
+	}
+	var dertTotalTicks uint64
+	if t.lastTotalTicks > 0 && totalTicks > t.lastTotalTicks {
+		dertTotalTicks = totalTicks - t.lastTotalTicks
+	}
+	lastTicks := t.lastTicks
+	t.lastTotalTicks, t.lastTicks = totalTicks, make(map[int32]uint64)
+
+	monitorPkgName := data.GetCmdParameters().GetMonitorPkgName()
+	processes := make([]*ProcessStatData, 0)
+	for _, p := range data.GetCmdParameters().GetTargetProcesses() {
+		ticks, err := readProcPidCpuTime(t.procPath, p.Pid)
+		if err != nil {
+			continue
+		}
+		status := utils.ParseProcKeyValue(utils.ReadFileString(filepath.Join(t.procPath, strconv.Itoa(int(p.Pid)), "status")))
+		process := &ProcessStatData{Pid: p.Pid, Name: ShortProcessName(p.Name, monitorPkgName), Ticks: ticks, Rss: status["VmRSS"]}
+		t.lastTicks[p.Pid] = ticks
+		//A new process is counted from the next interval
+		if last, ok := lastTicks[p.Pid]; ok && ticks >= last && dertTotalTicks > 0 {
+			process.Usage = float64(ticks-last) * 100 / float64(dertTotalTicks)
+		}
+		processes = append(processes, process)
+	}
+	sort.SliceStable(processes, func(i, j int) bool {
+		return processes[i].Usage > processes[j].Usage
+	})
+	t.processes = processes
+}
+
+func (t *ProcessStatPlugin) GetData() map[string]string {
+	if !data.GetCmdParameters().IsPkgResolved() {
+		return map[string]string{"procs": "", "proc_detail": ""}
+	}
+	processes := t.processes
+	details := make([]string, 0)
+	for _, process := range processes {
+		details = append(details, fmt.Sprintf("%s=%.1f%%/%.0fMB", process.Name, process.Usage, float64(process.Rss)/1024))
+	}
+	return map[string]string{
+		"procs":       strconv.Itoa(len(processes)),
+		"proc_detail": strings.Join(details, " "),
+	}
+}
@@ -0,0 +1,21 @@
+package plugins
+
+import (
+	"testing"
+)
+
+func TestProcessUnresolvedPackage(t *testing.T) {
+	plugin := &ProcessStatPlugin{processes: []*ProcessStatData{{Pid: 1234, Name: "main", Usage: 12.5, Rss: 204800}}}
+	if ret := plugin.GetData(); ret["procs"] != "1" || ret["proc_detail"] != "main=12.5%/200MB" {
+		t.Errorf("ERROR: data=%v, expect the main process", ret)
+	}
+	setUnresolvedPackage(t)
+	if ret := plugin.GetData(); ret["procs"] != "" || ret["proc_detail"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty columns before the package is resolved", ret)
+	}
+
+	system := &SystemStatPlugin{cpuUsage: 35, memPercent: 12.5}
+	if ret := system.GetData(); ret["cpu_usg"] != "" || ret["mem_usg"] != "" || ret["mem_swap"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty system columns instead of the device", ret)
+	}
+}
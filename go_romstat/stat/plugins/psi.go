@@ -0,0 +1,132 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+var psiResources = []string{"cpu", "memory", "io"}
+
+type PressureData struct {
+	Avg10 float64 //percent of the time stalled in the last 10 seconds
+	Total int64   //total stall time in microseconds
+}
+
+// ParsePressure parses a file of /proc/pressure, the key is 'some' or 'full'
+func ParsePressure(content string) map[string]*PressureData {
+	ret := make(map[string]*PressureData)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "some" && fields[0] != "full") {
+			continue
+		}
+		pressure := new(PressureData)
+		var hasAvg10, hasTotal bool
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			var err error
+			if kv[0] == "avg10" {
+				pressure.Avg10, err = strconv.ParseFloat(kv[1], 64)
+				hasAvg10 = err == nil
+			} else if kv[0] == "total" {
+				pressure.Total, err = strconv.ParseInt(kv[1], 10, 64)
+				hasTotal = err == nil
+			}
+		}
+		if hasAvg10 && hasTotal {
+			ret[fields[0]] = pressure
+		}
+	}
+	return ret
+}
+
+type PsiStatPlugin struct {
+	EventRecorder
+
+	sysRoot     string //root of the procfs, '/' for the device
+	isAvailable bool
+
+	lastPressure map[string]map[string]*PressureData //resource -> some/full
+	pressure     map[string]map[string]*PressureData
+}
+
+// NewPsiStatPlugin returns the plugin reading the procfs under sysRoot
+func NewPsiStatPlugin(sysRoot string) *PsiStatPlugin {
+	return &PsiStatPlugin{sysRoot: sysRoot}
+}
+
+// Open keeps the plugin without PSI, the columns are empty and the missing PSI is reported once by an event
+func (t *PsiStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	//PSI is not available if the kernel is built without CONFIG_PSI or booted with psi=0
+	t.isAvailable = len(ParsePressure(utils.ReadFileString(filepath.Join(t.sysRoot, "proc/pressure/cpu")))) > 0
+	if !t.isAvailable {
+		t.RecordEvent("psi_unavailable", "pressure stall information is not supported by the kernel")
+	}
+	return true
+}
+
+func (t *PsiStatPlugin) Close() {
+}
+
+func (t *PsiStatPlugin) Run() {
+	if !t.isAvailable {
+		return
+	}
+	t.collectPsiStat()
+	go utils.SetTimer(1, t.collectPsiStat)
+}
+
+func (t *PsiStatPlugin) GetTypes() []*data.PluginType {
+	types := make([]*data.PluginType, 0)
+	for _, resource := range psiResources {
+		types = append(types,
+			&data.PluginType{Name: fmt.Sprintf("psi_%s_some", resource), DisplayName: resource + "Some%", IsCmdShow: true},
+			&data.PluginType{Name: fmt.Sprintf("psi_%s_full", resource), DisplayName: resource + "Full%", IsCmdShow: false},
+			&data.PluginType{Name: fmt.Sprintf("psi_%s_some_stall", resource), DisplayName: resource + "Some(ms)", IsCmdShow: false},
+			&data.PluginType{Name: fmt.Sprintf("psi_%s_full_stall", resource), DisplayName: resource + "Full(ms)", IsCmdShow: false})
+	}
+	return types
+}
+
+func (t *PsiStatPlugin) collectPsiStat() {
+	pressure := make(map[string]map[string]*PressureData)
+	for _, resource := range psiResources {
+		pressure[resource] = ParsePressure(utils.ReadFileString(filepath.Join(t.sysRoot, "proc/pressure", resource)))
+	}
+	t.lastPressure, t.pressure = t.pressure, pressure
+}
+
+func (t *PsiStatPlugin) GetData() map[string]string {
+	ret := make(map[string]string)
+	lastPressure, pressure := t.lastPressure, t.pressure
+	for _, resource := range psiResources {
+		for _, kind := range []string{"some", "full"} {
+			avgKey := fmt.Sprintf("psi_%s_%s", resource, kind)
+			stallKey := fmt.Sprintf("psi_%s_%s_stall", resource, kind)
+			ret[avgKey], ret[stallKey] = "", ""
+			current, ok := pressure[resource][kind]
+			if !ok {
+				continue
+			}
+			ret[avgKey] = fmt.Sprintf("%.2f", current.Avg10)
+			if last, ok := lastPressure[resource][kind]; ok && current.Total >= last.Total {
+				ret[stallKey] = fmt.Sprintf("%.1f", float64(current.Total-last.Total)/1000)
+			}
+		}
+	}
+	return ret
+}
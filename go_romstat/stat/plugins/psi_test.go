@@ -0,0 +1,45 @@
+package plugins
+
+import (
+	"testing"
+)
+
+func TestPsiStat(t *testing.T) {
+	root := t.TempDir()
+	writeFakeFile(t, root, "proc/pressure/cpu", "some avg10=12.50 avg60=8.00 avg300=2.10 total=1000000\n")
+	writeFakeFile(t, root, "proc/pressure/memory", "some avg10=0.00 avg60=0.00 avg300=0.00 total=200\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=100\n")
+	writeFakeFile(t, root, "proc/pressure/io", "garbage\n")
+	plugin := &PsiStatPlugin{sysRoot: root}
+	if !plugin.Open() {
+		t.Fatal("ERROR: psi should be available")
+	}
+	plugin.collectPsiStat()
+	writeFakeFile(t, root, "proc/pressure/cpu", "some avg10=20.00 avg60=9.00 avg300=2.20 total=1250000\n")
+	plugin.collectPsiStat()
+	ret := plugin.GetData()
+	expect := map[string]string{
+		"psi_cpu_some":          "20.00",
+		"psi_cpu_some_stall":    "250.0",
+		"psi_cpu_full":          "",
+		"psi_memory_full":       "0.00",
+		"psi_memory_full_stall": "0.0",
+		"psi_io_some":           "",
+		"psi_io_some_stall":     "",
+	}
+	for k, v := range expect {
+		if ret[k] != v {
+			t.Errorf("ERROR: %s=%s, expect %s", k, ret[k], v)
+		}
+	}
+
+	plugin = &PsiStatPlugin{sysRoot: t.TempDir()}
+	if !plugin.Open() || plugin.isAvailable {
+		t.Error("ERROR: psi should be opened as unavailable")
+	}
+	if events := plugin.GetEvents(); len(events) != 1 || events[0].Name != "psi_unavailable" {
+		t.Errorf("ERROR: events=%v, expect one psi_unavailable event", events)
+	}
+	if ret := plugin.GetData(); len(ret) != len(plugin.GetTypes()) || ret["psi_cpu_some"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty columns", ret)
+	}
+}
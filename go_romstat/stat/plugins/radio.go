@@ -0,0 +1,353 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+var (
+	rWifiInfo      = regexp.MustCompile(`(?:mWifiInfo|WifiInfo:) SSID:[^\n]*`)
+	rWifiBssid     = regexp.MustCompile(`BSSID: ([0-9a-fA-F:]{17})`)
+	rWifiState     = regexp.MustCompile(`Supplicant state: (\w+)`)
+	rWifiRssi      = regexp.MustCompile(`RSSI: (-?\d+)`)
+	rWifiLinkSpeed = regexp.MustCompile(`, Link speed: (-?\d+)Mbps`)
+	rWifiFrequency = regexp.MustCompile(`Frequency: (-?\d+)MHz`)
+
+	rCellDataInService = regexp.MustCompile(`mDataRegState=0\(`)
+	rCellDisplayInfo   = regexp.MustCompile(`TelephonyDisplayInfo \{network=(\w+), overrideNetwork=(\w+)`)
+	rCellRadioTech     = regexp.MustCompile(`RilDataRadioTechnology=\d+\((\w+)\)`)
+	rCellLteSignal     = regexp.MustCompile(`mLte=CellSignalStrengthLte: rssi=-?\d+ rsrp=(-?\d+) rsrq=(-?\d+) rssnr=(-?\d+)`)
+	rCellNrSignal      = regexp.MustCompile(`mNr=CellSignalStrengthNr:\{[^}]*ssRsrp = (-?\d+) ssRsrq = (-?\d+) ssSinr = (-?\d+)`)
+	rCellIdentity      = regexp.MustCompile(`CellIdentity(?:Lte|Nr):\{([^}]*)\}`)
+	rCellPci           = regexp.MustCompile(`mPci\s*=\s*(\d+)`)
+	rCellCi            = regexp.MustCompile(`m(?:Ci|Nci)\s*=\s*(\d+)`)
+)
+
+type WifiLinkInfo struct {
+	Connected bool
+	Bssid     string //empty if not reported
+	Rssi      int    //dBm
+	LinkSpeed int    //Mbps, -1 if not reported
+	Frequency int    //MHz, -1 if not reported
+}
+
+// Band returns the frequency band of the link, e.g. 5G
+func (t *WifiLinkInfo) Band() string {
+	switch {
+	case t.Frequency >= 2400 && t.Frequency < 2500:
+		return "2.4G"
+	case t.Frequency >= 4900 && t.Frequency < 5925:
+		return "5G"
+	case t.Frequency >= 5925 && t.Frequency <= 7125:
+		return "6G"
+	}
+	return ""
+}
+
+// ParseDumpsysWifi parses the primary wifi link of 'dumpsys wifi', it returns nil if wifi info is not dumped
+func ParseDumpsysWifi(output string) *WifiLinkInfo {
+	line := rWifiInfo.FindString(output)
+	if line == "" {
+		return nil
+	}
+	ret := &WifiLinkInfo{LinkSpeed: -1, Frequency: -1}
+	if sz := rWifiState.FindStringSubmatch(line); len(sz) > 1 {
+		ret.Connected = sz[1] == "COMPLETED"
+	}
+	if !ret.Connected {
+		return ret
+	}
+	if sz := rWifiBssid.FindStringSubmatch(line); len(sz) > 1 {
+		ret.Bssid = strings.ToLower(sz[1])
+	}
+	if sz := rWifiRssi.FindStringSubmatch(line); len(sz) > 1 {
+		ret.Rssi, _ = strconv.Atoi(sz[1])
+	}
+	if sz := rWifiLinkSpeed.FindStringSubmatch(line); len(sz) > 1 {
+		ret.LinkSpeed, _ = strconv.Atoi(sz[1])
+	}
+	if sz := rWifiFrequency.FindStringSubmatch(line); len(sz) > 1 {
+		ret.Frequency, _ = strconv.Atoi(sz[1])
+	}
+	return ret
+}
+
+// ParseCmdWifiStatus parses the primary wifi link of 'cmd wifi status' of android 11+,
+// it returns nil if the command is not supported
+func ParseCmdWifiStatus(output string) *WifiLinkInfo {
+	if ret := ParseDumpsysWifi(output); ret != nil {
+		return ret
+	}
+	if strings.Contains(output, "Wifi is not connected") || strings.Contains(output, "Wifi is disabled") {
+		return &WifiLinkInfo{LinkSpeed: -1, Frequency: -1}
+	}
+	return nil
+}
+
+// ParseProcNetWireless parses the signal level of the first interface in /proc/net/wireless,
+// it is the fallback if the wifi service is not dumped
+func ParseProcNetWireless(content string) *WifiLinkInfo {
+	for _, line := range strings.Split(content, "\n") {
+		idx := strings.Index(line, ":")
+		if idx < 0 || strings.Contains(line, "|") {
+			continue
+		}
+		fields := strings.Fields(line[idx+1:])
+		if len(fields) < 3 {
+			continue
+		}
+		level, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		if err != nil {
+			continue
+		}
+		//some drivers report the level in unsigned 8 bits
+		if level > 0 {
+			level -= 256
+		}
+		return &WifiLinkInfo{Connected: true, Rssi: int(level), LinkSpeed: -1, Frequency: -1}
+	}
+	return nil
+}
+
+// cellUnavailable is the value of the signal not reported by the modem
+const cellUnavailable = math.MaxInt32
+
+type CellLinkInfo struct {
+	Type string //LTE, NR, NR_NSA...
+	Rsrp int    //dBm
+	Rsrq int    //dB
+	Sinr int    //dB
+	Cell string //pci/ci of the serving cell, empty if not reported
+}
+
+func parseCellSignal(sz []string) (int, int, int, bool) {
+	values := make([]int, 3)
+	for idx := range values {
+		values[idx] = cellUnavailable
+		if value, err := strconv.Atoi(sz[idx+1]); err == nil && value > math.MinInt32 && value < math.MaxInt32 {
+			values[idx] = value
+		}
+	}
+	return values[0], values[1], values[2], values[0] != cellUnavailable
+}
+
+// parseCellPhone parses the section of a phone in 'dumpsys telephony.registry'
+func parseCellPhone(section string) *CellLinkInfo {
+	ret := &CellLinkInfo{Rsrp: cellUnavailable, Rsrq: cellUnavailable, Sinr: cellUnavailable}
+	if sz := rCellDisplayInfo.FindStringSubmatch(section); len(sz) > 2 {
+		ret.Type = sz[1]
+		if strings.HasPrefix(sz[2], "NR_") && sz[1] != "NR" {
+			ret.Type = "NR_NSA"
+		}
+	} else if sz := rCellRadioTech.FindStringSubmatch(section); len(sz) > 1 {
+		ret.Type = sz[1]
+		if ret.Type == "LTE" && strings.Contains(section, "nrState=CONNECTED") {
+			ret.Type = "NR_NSA"
+		}
+	}
+	if ret.Type == "UNKNOWN" || ret.Type == "Unknown" {
+		ret.Type = ""
+	}
+
+	var hasLte, hasNr bool
+	var lte, nr [3]int
+	if sz := rCellLteSignal.FindStringSubmatch(section); len(sz) > 3 {
+		lte[0], lte[1], lte[2], hasLte = parseCellSignal(sz)
+	}
+	if sz := rCellNrSignal.FindStringSubmatch(section); len(sz) > 3 {
+		nr[0], nr[1], nr[2], hasNr = parseCellSignal(sz)
+	}
+	if hasNr && (strings.HasPrefix(ret.Type, "NR") || !hasLte) {
+		ret.Rsrp, ret.Rsrq, ret.Sinr = nr[0], nr[1], nr[2]
+	} else if hasLte {
+		ret.Rsrp, ret.Rsrq, ret.Sinr = lte[0], lte[1], lte[2]
+	}
+
+	if sz := rCellIdentity.FindStringSubmatch(section); len(sz) > 1 {
+		pci, ci := rCellPci.FindStringSubmatch(sz[1]), rCellCi.FindStringSubmatch(sz[1])
+		if len(pci) > 1 && len(ci) > 1 {
+			ret.Cell = pci[1] + "/" + ci[1]
+		}
+	}
+	return ret
+}
+
+// ParseTelephonyRegistry parses the cellular link of 'dumpsys telephony.registry', the phone with data in service
+// is preferred on the multi sim devices, it returns nil if no phone has the cellular signal
+func ParseTelephonyRegistry(output string) *CellLinkInfo {
+	var ret *CellLinkInfo
+	sections := strings.Split(output, "Phone Id=")
+	for _, section := range sections[1:] {
+		phone := parseCellPhone(section)
+		if phone.Rsrp == cellUnavailable && phone.Type == "" {
+			continue
+		}
+		if rCellDataInService.MatchString(section) {
+			return phone
+		}
+		if ret == nil {
+			ret = phone
+		}
+	}
+	return ret
+}
+
+type RadioStatPlugin struct {
+	EventRecorder
+
+	procPath      string
+	shell         *utils.AndroidShell
+	hasWifiStatus bool //'cmd wifi status' is supported, it is much lighter than the dump of the wifi service
+	skipRounds    int  //the rounds left to use the dump of the wifi service after 'cmd wifi status' failed
+
+	lock      sync.Mutex    //the links are updated by the timer and read by GetData
+	wifi      *WifiLinkInfo //nil if wifi is not available
+	cell      *CellLinkInfo //nil if no cellular signal
+	wifiState string        //the last reported states, they are kept while the link is not reported
+	cellType  string
+	lastWifi  *WifiLinkInfo //the last link with a bssid, the roam across a disconnection is recorded too
+	lastCell  *CellLinkInfo //the last link with a serving cell
+}
+
+func (t *RadioStatPlugin) Open() bool {
+	if t.procPath == "" {
+		t.procPath = "/proc"
+	}
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	t.hasWifiStatus = t.shell.GetSdkVersion() >= 30
+	return true
+}
+
+func (t *RadioStatPlugin) Close() {
+}
+
+func (t *RadioStatPlugin) Run() {
+	//the dumps of the wifi and telephony services are heavy
+	go utils.SetTimer(2, t.collectRadioStat)
+}
+
+func (t *RadioStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "wifi_rssi", DisplayName: "rssi(dBm)", IsCmdShow: true},
+		{Name: "wifi_link_speed", DisplayName: "linkSpeed(Mbps)", IsCmdShow: false},
+		{Name: "wifi_freq", DisplayName: "freq(MHz)", IsCmdShow: false},
+		{Name: "wifi_band", DisplayName: "band", IsCmdShow: false},
+		{Name: "wifi_bssid", DisplayName: "bssid", IsCmdShow: false},
+		{Name: "cell_type", DisplayName: "cellType", IsCmdShow: true},
+		{Name: "cell_rsrp", DisplayName: "rsrp(dBm)", IsCmdShow: true},
+		{Name: "cell_rsrq", DisplayName: "rsrq(dB)", IsCmdShow: false},
+		{Name: "cell_sinr", DisplayName: "sinr(dB)", IsCmdShow: false},
+		{Name: "cell_id", DisplayName: "cell", IsCmdShow: false},
+	}
+}
+
+// wifiStatusRetryRounds is the rounds to fall back to the dump of the wifi service after 'cmd wifi status' failed,
+// the command fails while the wifi service is restarting, so it is retried later instead of being disabled
+const wifiStatusRetryRounds = 30
+
+// useWifiStatus returns whether 'cmd wifi status' is run in this round
+func (t *RadioStatPlugin) useWifiStatus() bool {
+	if !t.hasWifiStatus {
+		return false
+	}
+	if t.skipRounds > 0 {
+		t.skipRounds--
+		return false
+	}
+	return true
+}
+
+func (t *RadioStatPlugin) collectRadioStat() {
+	var wifi *WifiLinkInfo
+	if t.useWifiStatus() {
+		wifi = ParseCmdWifiStatus(t.shell.RunShell("cmd wifi status"))
+		if wifi == nil {
+			t.skipRounds = wifiStatusRetryRounds
+		}
+	}
+	if wifi == nil {
+		wifi = ParseDumpsysWifi(t.shell.RunShell("dumpsys wifi"))
+	}
+	if wifi == nil {
+		wifi = ParseProcNetWireless(utils.ReadFileString(filepath.Join(t.procPath, "net/wireless")))
+	}
+	t.update(wifi, ParseTelephonyRegistry(t.shell.RunShell("dumpsys telephony.registry")))
+}
+
+// update records the handovers and the network type changes against the last reported values, and keeps the links
+func (t *RadioStatPlugin) update(wifi *WifiLinkInfo, cell *CellLinkInfo) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if wifi != nil {
+		t.RecordChangeEvent("wifi_state", t.wifiState, wifiStateName(wifi))
+		t.wifiState = wifiStateName(wifi)
+	}
+	if wifi != nil && wifi.Bssid != "" {
+		if last := t.lastWifi; last != nil && last.Bssid != wifi.Bssid {
+			t.RecordEvent("wifi_roam", fmt.Sprintf("%s(%s %ddBm) -> %s(%s %ddBm)", last.Bssid, last.Band(), last.Rssi, wifi.Bssid, wifi.Band(), wifi.Rssi))
+		}
+		t.lastWifi = wifi
+	}
+	if cell != nil && cell.Type != "" {
+		t.RecordChangeEvent("cell_type", t.cellType, cell.Type)
+		t.cellType = cell.Type
+	}
+	if cell != nil && cell.Cell != "" {
+		if last := t.lastCell; last != nil && last.Cell != cell.Cell {
+			t.RecordEvent("cell_handover", fmt.Sprintf("%s(%s) -> %s(%s)", last.Cell, last.Type, cell.Cell, cell.Type))
+		}
+		t.lastCell = cell
+	}
+	t.wifi = wifi
+	t.cell = cell
+}
+
+func wifiStateName(wifi *WifiLinkInfo) string {
+	if wifi.Connected {
+		return "connected"
+	}
+	return "disconnected"
+}
+
+func (t *RadioStatPlugin) GetData() map[string]string {
+	ret := make(map[string]string)
+	for _, name := range []string{"wifi_rssi", "wifi_link_speed", "wifi_freq", "wifi_band", "wifi_bssid", "cell_type", "cell_rsrp", "cell_rsrq", "cell_sinr", "cell_id"} {
+		ret[name] = ""
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if wifi := t.wifi; wifi != nil && wifi.Connected {
+		ret["wifi_rssi"] = strconv.Itoa(wifi.Rssi)
+		if wifi.LinkSpeed > 0 {
+			ret["wifi_link_speed"] = strconv.Itoa(wifi.LinkSpeed)
+		}
+		if wifi.Frequency > 0 {
+			ret["wifi_freq"] = strconv.Itoa(wifi.Frequency)
+		}
+		ret["wifi_band"] = wifi.Band()
+		ret["wifi_bssid"] = wifi.Bssid
+	}
+	if cell := t.cell; cell != nil {
+		ret["cell_type"] = cell.Type
+		for name, value := range map[string]int{"cell_rsrp": cell.Rsrp, "cell_rsrq": cell.Rsrq, "cell_sinr": cell.Sinr} {
+			if value != cellUnavailable {
+				ret[name] = strconv.Itoa(value)
+			}
+		}
+		ret["cell_id"] = cell.Cell
+	}
+	return ret
+}
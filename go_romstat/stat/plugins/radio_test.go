@@ -0,0 +1,187 @@
+package plugins
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseDumpsysWifi(t *testing.T) {
+	cases := []struct {
+		filename string
+		expect   WifiLinkInfo
+		band     string
+	}{
+		{"testdata/dumpsys_wifi_android11.txt", WifiLinkInfo{Connected: true, Bssid: "3c:84:6a:12:34:56", Rssi: -61, LinkSpeed: 144, Frequency: 2437}, "2.4G"},
+		{"testdata/dumpsys_wifi_android13.txt", WifiLinkInfo{Connected: true, Bssid: "a4:2b:b0:c1:d2:e3", Rssi: -48, LinkSpeed: 1201, Frequency: 5745}, "5G"},
+	}
+	for _, v := range cases {
+		output, err := os.ReadFile(v.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wifi := ParseDumpsysWifi(string(output))
+		if wifi == nil || *wifi != v.expect || wifi.Band() != v.band {
+			t.Errorf("ERROR: %s wifi=%+v, expect %+v", v.filename, wifi, v.expect)
+		}
+	}
+	wifi := ParseDumpsysWifi("mWifiInfo SSID: <unknown ssid>, BSSID: <none>, Supplicant state: DISCONNECTED, RSSI: -127, Link speed: -1Mbps, Frequency: -1MHz, Net ID: -1")
+	if wifi == nil || wifi.Connected {
+		t.Errorf("ERROR: wifi=%+v, expect disconnected", wifi)
+	}
+	if ParseDumpsysWifi("Can't find service: wifi") != nil {
+		t.Error("ERROR: wifi info without the service")
+	}
+}
+
+func TestParseCmdWifiStatus(t *testing.T) {
+	output := `Wifi is enabled
+Wifi scanning is always available
+==== Primary ClientModeManager instance ====
+Wifi is connected to "AndroidAP"
+WifiInfo: SSID: "AndroidAP", BSSID: 3C:84:6A:12:34:56, MAC: 02:00:00:00:00:00, Supplicant state: COMPLETED, Wi-Fi standard: 4, RSSI: -61, Link speed: 144Mbps, Tx Link speed: 144Mbps, Max Supported Tx Link speed: 144Mbps, Rx Link speed: 72Mbps, Max Supported Rx Link speed: 144Mbps, Frequency: 2437MHz, Net ID: 0, Metered hint: false, score: 60
+successfulTxPackets 1024
+`
+	expect := WifiLinkInfo{Connected: true, Bssid: "3c:84:6a:12:34:56", Rssi: -61, LinkSpeed: 144, Frequency: 2437}
+	if wifi := ParseCmdWifiStatus(output); wifi == nil || *wifi != expect {
+		t.Errorf("ERROR: wifi=%+v, expect %+v", wifi, expect)
+	}
+	for _, output := range []string{"Wifi is enabled\nWifi is not connected\n", "Wifi is disabled\nWifi is not connected\n"} {
+		if wifi := ParseCmdWifiStatus(output); wifi == nil || wifi.Connected {
+			t.Errorf("ERROR: %q wifi=%+v, expect disconnected", output, wifi)
+		}
+	}
+	if ParseCmdWifiStatus("Unknown command: status") != nil {
+		t.Error("ERROR: wifi info without the command")
+	}
+}
+
+func TestParseProcNetWireless(t *testing.T) {
+	content := `Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+ face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+ wlan0: 0000   57.  -53.  -256        0      0      0      0      0        0
+`
+	wifi := ParseProcNetWireless(content)
+	if wifi == nil || wifi.Rssi != -53 {
+		t.Errorf("ERROR: wifi=%+v, expect rssi -53", wifi)
+	}
+	if wifi = ParseProcNetWireless(content[:150]); wifi != nil {
+		t.Errorf("ERROR: wifi=%+v, expect nil without interface", wifi)
+	}
+}
+
+func TestParseTelephonyRegistry(t *testing.T) {
+	cases := []struct {
+		filename string
+		expect   CellLinkInfo
+	}{
+		{"testdata/telephony_registry_android10.txt", CellLinkInfo{Type: "LTE", Rsrp: -104, Rsrq: -14, Sinr: -3, Cell: "41/12345678"}},
+		{"testdata/telephony_registry_android12.txt", CellLinkInfo{Type: "NR_NSA", Rsrp: -88, Rsrq: -10, Sinr: 17, Cell: "270/87654321"}},
+	}
+	for _, v := range cases {
+		output, err := os.ReadFile(v.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cell := ParseTelephonyRegistry(string(output))
+		if cell == nil || *cell != v.expect {
+			t.Errorf("ERROR: %s cell=%+v, expect %+v", v.filename, cell, v.expect)
+		}
+	}
+	if cell := ParseTelephonyRegistry("last known state:\n  Phone Id=0\n    mSignalStrength=SignalStrength:{mLte=Invalid mNr=Invalid}\n"); cell != nil {
+		t.Errorf("ERROR: cell=%+v, expect nil without signal", *cell)
+	}
+}
+
+func TestRadioEvents(t *testing.T) {
+	plugin := &RadioStatPlugin{}
+	plugin.update(&WifiLinkInfo{Connected: true, Bssid: "3c:84:6a:12:34:56", Rssi: -75, Frequency: 5180}, &CellLinkInfo{Type: "LTE", Rsrp: -100, Cell: "41/12345678"})
+	plugin.update(&WifiLinkInfo{Connected: true, Bssid: "3c:84:6a:12:34:57", Rssi: -50, Frequency: 2412}, &CellLinkInfo{Type: "NR_NSA", Rsrp: -90, Cell: "270/87654321"})
+	plugin.update(&WifiLinkInfo{}, nil)
+	expect := []string{"wifi_roam", "cell_type", "cell_handover", "wifi_state"}
+	events := plugin.GetEvents()
+	if len(events) != len(expect) {
+		t.Fatalf("ERROR: events=%d, expect %v", len(events), expect)
+	}
+	for idx, event := range events {
+		if event.Name != expect[idx] {
+			t.Errorf("ERROR: event %d=%s %s, expect %s", idx, event.Name, event.Detail, expect[idx])
+		}
+	}
+	if events[0].Detail != "3c:84:6a:12:34:56(5G -75dBm) -> 3c:84:6a:12:34:57(2.4G -50dBm)" {
+		t.Errorf("ERROR: roam detail=%s", events[0].Detail)
+	}
+	if ret := plugin.GetData(); ret["wifi_rssi"] != "" || ret["cell_type"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty columns after disconnected", ret)
+	}
+
+	//the type is not reported in a sample, the change after it is still recorded
+	plugin.update(nil, &CellLinkInfo{Type: "", Rsrp: -110, Cell: "270/87654321"})
+	plugin.update(nil, &CellLinkInfo{Type: "LTE", Rsrp: -100, Cell: "270/87654321"})
+	if events = plugin.GetEvents(); len(events) != 1 || events[0].Name != "cell_type" || events[0].Detail != "NR_NSA -> LTE" {
+		t.Errorf("ERROR: events=%v, expect the cell type change NR_NSA -> LTE", events)
+	}
+
+	//the link changes while it is not reported or disconnected, the changes are still recorded
+	plugin.update(nil, nil)
+	plugin.update(&WifiLinkInfo{Connected: true, Bssid: "3c:84:6a:12:34:58", Rssi: -60, Frequency: 5745}, &CellLinkInfo{Type: "LTE", Rsrp: -95, Cell: "41/12345678"})
+	expect = []string{"wifi_state", "wifi_roam", "cell_handover"}
+	events = plugin.GetEvents()
+	if len(events) != len(expect) {
+		t.Fatalf("ERROR: events=%v, expect %v", events, expect)
+	}
+	for idx, event := range events {
+		if event.Name != expect[idx] {
+			t.Errorf("ERROR: event %d=%s %s, expect %s", idx, event.Name, event.Detail, expect[idx])
+		}
+	}
+	if events[1].Detail != "3c:84:6a:12:34:57(2.4G -50dBm) -> 3c:84:6a:12:34:58(5G -60dBm)" {
+		t.Errorf("ERROR: roam detail=%s", events[1].Detail)
+	}
+	if events[2].Detail != "270/87654321(LTE) -> 41/12345678(LTE)" {
+		t.Errorf("ERROR: handover detail=%s", events[2].Detail)
+	}
+}
+
+func TestRadioWifiStatusRetry(t *testing.T) {
+	plugin := &RadioStatPlugin{hasWifiStatus: true}
+	if !plugin.useWifiStatus() {
+		t.Errorf("ERROR: cmd wifi status is not used")
+	}
+	//the command failed, the dump of the wifi service is used for a while and the command is retried then
+	plugin.skipRounds = wifiStatusRetryRounds
+	for idx := 0; idx < wifiStatusRetryRounds; idx++ {
+		if plugin.useWifiStatus() {
+			t.Fatalf("ERROR: cmd wifi status is used in round %d after it failed", idx)
+		}
+	}
+	if !plugin.useWifiStatus() {
+		t.Errorf("ERROR: cmd wifi status is not retried after %d rounds", wifiStatusRetryRounds)
+	}
+
+	plugin = &RadioStatPlugin{}
+	if plugin.useWifiStatus() {
+		t.Errorf("ERROR: cmd wifi status is used before android 11")
+	}
+}
+
+func TestRadioConcurrentData(t *testing.T) {
+	plugin := &RadioStatPlugin{}
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			plugin.update(&WifiLinkInfo{Connected: true, Bssid: "3c:84:6a:12:34:56", Rssi: -60 - i%2, Frequency: 5180}, &CellLinkInfo{Type: "LTE", Rsrp: -100, Cell: "41/12345678"})
+		}
+		close(done)
+	}()
+	for isDone := false; !isDone; {
+		select {
+		case <-done:
+			isDone = true
+		default:
+			plugin.GetData()
+		}
+	}
+	if ret := plugin.GetData(); ret["wifi_rssi"] != "-61" || ret["cell_rsrp"] != "-100" {
+		t.Errorf("ERROR: data=%v", ret)
+	}
+}
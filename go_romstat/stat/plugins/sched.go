@@ -0,0 +1,181 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+type SchedStatData struct {
+	VoluntarySwitches   int64
+	InvoluntarySwitches int64
+	MinorFaults         int64
+	MajorFaults         int64
+	RunTime             int64 //nanoseconds running on cpu
+	WaitTime            int64 //nanoseconds waiting on a run queue
+}
+
+type SchedStatPlugin struct {
+	sysRoot string //root of the procfs, '/' for the device
+
+	lastTimestamp time.Time
+	lastPid       int32
+	lastStat      *SchedStatData         //faults of the process
+	lastThreads   map[int]*SchedStatData //context switches and schedstat keyed by the tid
+
+	vcswPerSec    float64
+	ivcswPerSec   float64
+	minFltPerSec  float64
+	majFltPerSec  float64
+	waitPerSec    float64 //milliseconds waiting on a run queue per second
+	waitPercent   float64 //percent of the runnable time spent waiting
+	hasSchedStats bool
+}
+
+func (t *SchedStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	return true
+}
+
+func (t *SchedStatPlugin) Close() {
+}
+
+func (t *SchedStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectSchedStat)
+}
+
+func (t *SchedStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "vcsw", DisplayName: "vcsw/s", IsCmdShow: true},
+		{Name: "ivcsw", DisplayName: "ivcsw/s", IsCmdShow: true},
+		{Name: "minflt", DisplayName: "minflt/s", IsCmdShow: false},
+		{Name: "majflt", DisplayName: "majflt/s", IsCmdShow: true},
+		{Name: "runq_wait", DisplayName: "wait(ms)", IsCmdShow: true},
+		{Name: "runq_wait_percent", DisplayName: "wait%", IsCmdShow: false},
+	}
+}
+
+// readSchedStat reads the process faults from /proc/<pid>/stat, and the context switches and
+// the schedstat of every thread keyed by the tid, since /proc/<pid>/status and /proc/<pid>/schedstat
+// only count the main thread
+func (t *SchedStatPlugin) readSchedStat(pid int32) (*SchedStatData, map[int]*SchedStatData, bool) {
+	pidPath := filepath.Join(t.sysRoot, "proc", strconv.Itoa(int(pid)))
+	_, fields := utils.SplitProcStat(utils.ReadFileString(filepath.Join(pidPath, "stat")))
+	if len(fields) < 10 {
+		return nil, nil, false
+	}
+	ret := new(SchedStatData)
+	ret.MinorFaults, _ = strconv.ParseInt(fields[7], 10, 64)
+	ret.MajorFaults, _ = strconv.ParseInt(fields[9], 10, 64)
+
+	taskPaths, _ := filepath.Glob(filepath.Join(pidPath, "task", "*"))
+	if len(taskPaths) == 0 {
+		taskPaths = []string{pidPath}
+	}
+	threads := make(map[int]*SchedStatData)
+	hasSchedStats := false
+	for _, taskPath := range taskPaths {
+		tid, err := strconv.Atoi(filepath.Base(taskPath))
+		if err != nil {
+			continue
+		}
+		status := utils.ParseProcKeyValue(utils.ReadFileString(filepath.Join(taskPath, "status")))
+		if len(status) == 0 {
+			//the thread exited
+			continue
+		}
+		thread := &SchedStatData{
+			VoluntarySwitches:   status["voluntary_ctxt_switches"],
+			InvoluntarySwitches: status["nonvoluntary_ctxt_switches"],
+		}
+		//schedstat: run time, wait time on a run queue, count of timeslices
+		schedFields := strings.Fields(utils.ReadFileString(filepath.Join(taskPath, "schedstat")))
+		if len(schedFields) >= 2 {
+			thread.RunTime, _ = strconv.ParseInt(schedFields[0], 10, 64)
+			thread.WaitTime, _ = strconv.ParseInt(schedFields[1], 10, 64)
+			hasSchedStats = true
+		}
+		threads[tid] = thread
+	}
+	return ret, threads, hasSchedStats
+}
+
+// threadsDelta sums the increments of every thread, so the exited threads do not drop the counts
+// of the others, the thread created in the interval is counted from 0
+func threadsDelta(current map[int]*SchedStatData, last map[int]*SchedStatData) *SchedStatData {
+	ret := new(SchedStatData)
+	for tid, thread := range current {
+		lastThread, ok := last[tid]
+		if !ok {
+			lastThread = new(SchedStatData)
+		}
+		ret.VoluntarySwitches += counterDelta(thread.VoluntarySwitches, lastThread.VoluntarySwitches)
+		ret.InvoluntarySwitches += counterDelta(thread.InvoluntarySwitches, lastThread.InvoluntarySwitches)
+		ret.RunTime += counterDelta(thread.RunTime, lastThread.RunTime)
+		ret.WaitTime += counterDelta(thread.WaitTime, lastThread.WaitTime)
+	}
+	return ret
+}
+
+func (t *SchedStatPlugin) collectSchedStat() {
+	now := time.Now()
+	elapsed := now.Sub(t.lastTimestamp).Seconds()
+	t.lastTimestamp = now
+
+	pid := data.GetCmdParameters().GetPid()
+	var current *SchedStatData
+	var threads map[int]*SchedStatData
+	if pid != 0 {
+		current, threads, t.hasSchedStats = t.readSchedStat(pid)
+	}
+	last := t.lastStat
+	t.vcswPerSec, t.ivcswPerSec, t.minFltPerSec, t.majFltPerSec, t.waitPerSec, t.waitPercent = 0, 0, 0, 0, 0, 0
+	if current != nil && last != nil && pid == t.lastPid && elapsed > 0 {
+		delta := threadsDelta(threads, t.lastThreads)
+		perSecond := func(delta int64) float64 {
+			return float64(delta) / elapsed
+		}
+		t.vcswPerSec = perSecond(delta.VoluntarySwitches)
+		t.ivcswPerSec = perSecond(delta.InvoluntarySwitches)
+		t.minFltPerSec = perSecond(counterDelta(current.MinorFaults, last.MinorFaults))
+		t.majFltPerSec = perSecond(counterDelta(current.MajorFaults, last.MajorFaults))
+		t.waitPerSec = perSecond(delta.WaitTime) / float64(time.Millisecond)
+		runTime := perSecond(delta.RunTime) / float64(time.Millisecond)
+		if runTime+t.waitPerSec > 0 {
+			t.waitPercent = t.waitPerSec * 100 / (runTime + t.waitPerSec)
+		}
+	}
+	t.lastPid, t.lastStat, t.lastThreads = pid, current, threads
+}
+
+func (t *SchedStatPlugin) GetData() map[string]string {
+	ret := map[string]string{
+		"vcsw":              fmt.Sprintf("%.0f", t.vcswPerSec),
+		"ivcsw":             fmt.Sprintf("%.0f", t.ivcswPerSec),
+		"minflt":            fmt.Sprintf("%.0f", t.minFltPerSec),
+		"majflt":            fmt.Sprintf("%.0f", t.majFltPerSec),
+		"runq_wait":         "",
+		"runq_wait_percent": "",
+	}
+	//schedstat is not available if the kernel is built without CONFIG_SCHED_INFO
+	if t.hasSchedStats {
+		ret["runq_wait"] = fmt.Sprintf("%.1f", t.waitPerSec)
+		ret["runq_wait_percent"] = fmt.Sprintf("%.1f", t.waitPercent)
+	}
+	if !data.GetCmdParameters().IsPkgResolved() {
+		for name := range ret {
+			ret[name] = ""
+		}
+	}
+	return ret
+}
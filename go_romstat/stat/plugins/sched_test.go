@@ -0,0 +1,64 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func writeFakeTask(t *testing.T, root string, tid string, vcsw int, ivcsw int, schedstat string) {
+	taskPath := filepath.Join("proc/1234/task", tid)
+	writeFakeFile(t, root, filepath.Join(taskPath, "status"), "Name:\tRenderThread\nvoluntary_ctxt_switches:\t"+
+		strconv.Itoa(vcsw)+"\nnonvoluntary_ctxt_switches:\t"+strconv.Itoa(ivcsw)+"\n")
+	writeFakeFile(t, root, filepath.Join(taskPath, "schedstat"), schedstat)
+}
+
+func TestSchedStatThreadExit(t *testing.T) {
+	root := t.TempDir()
+	writeFakeFile(t, root, "proc/1234/stat", "1234 (com.example.game) S 1 1234 0 0 -1 1077952832 1000 0 10 0 100 50 0 0 10 -10 30 0 12345 0 0")
+	writeFakeTask(t, root, "1234", 100, 10, "5000000 1000000 50")
+	writeFakeTask(t, root, "1240", 500, 50, "9000000 4000000 80")
+
+	plugin := &SchedStatPlugin{sysRoot: root}
+	last, lastThreads, ok := plugin.readSchedStat(1234)
+	if !ok || last == nil || len(lastThreads) != 2 {
+		t.Fatalf("ERROR: stat=%+v threads=%d ok=%v, expect 2 threads with schedstat", last, len(lastThreads), ok)
+	}
+
+	//the busy thread 1240 exits, 1250 is created
+	writeFakeFile(t, root, "proc/1234/stat", "1234 (com.example.game) S 1 1234 0 0 -1 1077952832 1500 0 12 0 100 50 0 0 10 -10 30 0 12345 0 0")
+	if err := os.RemoveAll(filepath.Join(root, "proc/1234/task/1240")); err != nil {
+		t.Fatal(err)
+	}
+	writeFakeTask(t, root, "1234", 130, 15, "7000000 1500000 60")
+	writeFakeTask(t, root, "1250", 20, 2, "1000000 500000 5")
+	current, threads, ok := plugin.readSchedStat(1234)
+	if !ok || len(threads) != 2 {
+		t.Fatalf("ERROR: threads=%d ok=%v, expect 2 threads", len(threads), ok)
+	}
+	delta := threadsDelta(threads, lastThreads)
+	expect := SchedStatData{VoluntarySwitches: 50, InvoluntarySwitches: 7, RunTime: 3000000, WaitTime: 1000000}
+	if *delta != expect {
+		t.Errorf("ERROR: delta=%+v, expect %+v", *delta, expect)
+	}
+	if minflt := counterDelta(current.MinorFaults, last.MinorFaults); minflt != 500 {
+		t.Errorf("ERROR: minflt=%d, expect 500", minflt)
+	}
+	if majflt := counterDelta(current.MajorFaults, last.MajorFaults); majflt != 2 {
+		t.Errorf("ERROR: majflt=%d, expect 2", majflt)
+	}
+}
+
+func TestSchedUnresolvedPackage(t *testing.T) {
+	plugin := &SchedStatPlugin{vcswPerSec: 120, hasSchedStats: true, waitPerSec: 3.5}
+	if ret := plugin.GetData(); ret["vcsw"] != "120" || ret["runq_wait"] != "3.5" {
+		t.Errorf("ERROR: data=%v, expect the sched stats of the app", ret)
+	}
+	setUnresolvedPackage(t)
+	for name, value := range plugin.GetData() {
+		if value != "" {
+			t.Errorf("ERROR: %s=%s, expect empty before the package is resolved", name, value)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+package plugins
+
+import (
+	"strconv"
+	"strings"
+
+	"romstat/stat/data"
+)
+
+// Jank types reported by the Android 12+ SurfaceFlinger FrameTimeline
+var frameTimelineJankTypes = []struct {
+	JankType    string
+	Name        string
+	DisplayName string
+}{
+	{JankType: "App Deadline Missed", Name: "ftl_app", DisplayName: "ftl_app"},
+	{JankType: "SurfaceFlinger CPU Deadline Missed", Name: "ftl_sf_cpu", DisplayName: "ftl_sfCpu"},
+	{JankType: "SurfaceFlinger GPU Deadline Missed", Name: "ftl_sf_gpu", DisplayName: "ftl_sfGpu"},
+	{JankType: "SurfaceFlinger Scheduling", Name: "ftl_sf_sched", DisplayName: "ftl_sfSched"},
+	{JankType: "SurfaceFlinger Stuffing", Name: "ftl_sf_stuffing", DisplayName: "ftl_sfStuffing"},
+	{JankType: "Buffer Stuffing", Name: "ftl_stuffing", DisplayName: "ftl_stuffing"},
+	{JankType: "Prediction Error", Name: "ftl_prediction", DisplayName: "ftl_prediction"},
+	{JankType: "Display HAL", Name: "ftl_display_hal", DisplayName: "ftl_hal"},
+	{JankType: "Dropped Frame", Name: "ftl_dropped", DisplayName: "ftl_dropped"},
+	{JankType: "Unknown", Name: "ftl_unknown", DisplayName: "ftl_unknown"},
+}
+
+type FrameTimelineData struct {
+	Frames     int            //count of surface frames of the target layer
+	JankFrames int            //count of surface frames classified as jank
+	JankTypes  map[string]int //count of frames per jank type, a frame may have several types
+}
+
+func NewFrameTimelineData() *FrameTimelineData {
+	return &FrameTimelineData{JankTypes: make(map[string]int)}
+}
+
+func getFrameTimelineTypes() []*data.PluginType {
+	types := []*data.PluginType{
+		{Name: "ftl_frames", DisplayName: "ftl_frames", IsCmdShow: false},
+		{Name: "ftl_jank", DisplayName: "ftl_jank", IsCmdShow: false},
+	}
+	for _, v := range frameTimelineJankTypes {
+		types = append(types, &data.PluginType{Name: v.Name, DisplayName: v.DisplayName, IsCmdShow: false})
+	}
+	return types
+}
+
+func (t *FrameTimelineData) outputData(ret map[string]string) {
+	ret["ftl_frames"] = strconv.Itoa(t.Frames)
+	ret["ftl_jank"] = strconv.Itoa(t.JankFrames)
+	for _, v := range frameTimelineJankTypes {
+		ret[v.Name] = strconv.Itoa(t.JankTypes[v.JankType])
+	}
+}
+
+// HasFrameTimelineLayer checks whether any layer in the output of 'dumpsys SurfaceFlinger --frametimeline -all'
+// is accepted by isTargetLayer
+func HasFrameTimelineLayer(output string, isTargetLayer func(layer string) bool) bool {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Layer - ") && isTargetLayer(strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "Layer - "), "[*]"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFrameTimeline parses the output of 'dumpsys SurfaceFlinger --frametimeline -all',
+// counts the surface frames of the layers accepted by isTargetLayer with a token newer than lastToken.
+// Returns the counts and the newest token seen for the target layers
+func ParseFrameTimeline(output string, isTargetLayer func(layer string) bool, lastToken int64) (*FrameTimelineData, int64) {
+	ret := NewFrameTimelineData()
+	maxToken := lastToken
+	inTargetFrame := false
+	var token int64
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Display Frame") {
+			inTargetFrame = false
+			continue
+		}
+		if strings.HasPrefix(line, "Layer - ") {
+			layer := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "Layer - "), "[*]"))
+			inTargetFrame = isTargetLayer(layer)
+			token = 0
+			continue
+		}
+		if !inTargetFrame {
+			continue
+		}
+		if strings.HasPrefix(line, "Token:") {
+			token, _ = strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "Token:")), 10, 64)
+			continue
+		}
+		if !strings.HasPrefix(line, "Jank Type") {
+			continue
+		}
+		//Every surface frame has exactly one jank type line, skip the frames counted by the previous dump
+		inTargetFrame = false
+		if token <= lastToken {
+			continue
+		}
+		if token > maxToken {
+			maxToken = token
+		}
+		ret.Frames += 1
+		idx := strings.Index(line, ":")
+		if idx < 0 {
+			continue
+		}
+		jankTypes := strings.TrimSpace(line[idx+1:])
+		if jankTypes == "None" || jankTypes == "" {
+			continue
+		}
+		ret.JankFrames += 1
+		for _, jankType := range strings.Split(jankTypes, ",") {
+			ret.JankTypes[strings.TrimSpace(jankType)] += 1
+		}
+	}
+	return ret, maxToken
+}
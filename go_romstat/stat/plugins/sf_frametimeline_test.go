@@ -0,0 +1,63 @@
+package plugins
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseFrameTimeline(t *testing.T) {
+	output, err := os.ReadFile("testdata/frametimeline_android12.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isTargetLayer := func(layer string) bool {
+		return strings.Contains(layer, "com.example.game")
+	}
+	timelineData, token := ParseFrameTimeline(string(output), isTargetLayer, 0)
+	if token != 20445 {
+		t.Errorf("ERROR: token=%d, expect 20445", token)
+	}
+	if timelineData.Frames != 3 {
+		t.Errorf("ERROR: timelineData.Frames=%d, expect 3", timelineData.Frames)
+	}
+	if timelineData.JankFrames != 2 {
+		t.Errorf("ERROR: timelineData.JankFrames=%d, expect 2", timelineData.JankFrames)
+	}
+	expectJankTypes := map[string]int{
+		"App Deadline Missed":                1,
+		"Buffer Stuffing":                    2,
+		"Prediction Error":                   1,
+		"SurfaceFlinger CPU Deadline Missed": 0,
+	}
+	for jankType, count := range expectJankTypes {
+		if timelineData.JankTypes[jankType] != count {
+			t.Errorf("ERROR: JankTypes[%s]=%d, expect %d", jankType, timelineData.JankTypes[jankType], count)
+		}
+	}
+
+	//The frames counted by the previous dump should be skipped
+	timelineData, token = ParseFrameTimeline(string(output), isTargetLayer, 20425)
+	if token != 20445 || timelineData.Frames != 1 || timelineData.JankFrames != 1 {
+		t.Errorf("ERROR: token=%d, frames=%d, jankFrames=%d, expect 20445, 1, 1", token, timelineData.Frames, timelineData.JankFrames)
+	}
+}
+
+func TestHasFrameTimelineLayer(t *testing.T) {
+	output, err := os.ReadFile("testdata/frametimeline_android12.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for surfaceView, expect := range map[string]bool{
+		"SurfaceView[com.example.game/com.example.game.MainActivity](BLAST)#312": true,
+		"SurfaceView[com.example.game/com.example.game.MainActivity]":            true,
+		"com.example.game/com.example.game.MainActivity#305":                     false,
+	} {
+		isTargetLayer := func(layer string) bool {
+			return layer == surfaceView || strings.HasPrefix(layer, surfaceView)
+		}
+		if ret := HasFrameTimelineLayer(string(output), isTargetLayer); ret != expect {
+			t.Errorf("ERROR: %s matched=%v, expect %v", surfaceView, ret, expect)
+		}
+	}
+}
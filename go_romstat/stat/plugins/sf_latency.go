@@ -31,6 +31,15 @@ type OutputFrameData struct {
 	JankTotalTs int64 //duration of total jank times per second
 }
 
+// State of the monitored application
+const (
+	AppStateForeground = "foreground"
+	AppStateBackground = "background"
+	AppStateScreenOff  = "screen-off"
+	AppStateNotRunning = "not-running"
+	AppStateUnknown    = "unknown"
+)
+
 // For Android Only
 type SfPkgSurfaceData struct {
 	PkgName     string
@@ -49,6 +58,8 @@ type DesktopFramerateCoutner struct {
 }
 
 type SfLatencyStatPlugin struct {
+	EventRecorder
+
 	lastSmallJank3Frames []*SfFrameData //Data of the last small jank frames
 	lastJank3Frames      []*SfFrameData //Data of the last 3 frames
 	secOuputFrameData    *OutputFrameData
@@ -61,7 +72,11 @@ type SfLatencyStatPlugin struct {
 
 	lastFpsTimestamp int64
 
-	monitorProcessName string
+	topActivity     string    //Component name of the resumed activity
+	switchActivity  string    //Last foreground activity recorded as app switch event
+	surfaceActivity string    //Activity of the current surface view
+	appState        string    //State of the monitored application
+	appStateUpdated time.Time //Last time of the app state refresh
 
 	debugLog         utils.Logger
 	shell            *utils.AndroidShell
@@ -69,6 +84,15 @@ type SfLatencyStatPlugin struct {
 	lockedPkgSurface *SfPkgSurfaceData
 
 	d3dxLoopCounter *DesktopFramerateCoutner
+
+	frameTimelineLock  sync.Mutex
+	frameTimelineData  *FrameTimelineData //FrameTimeline jank classification per second
+	frameTimelineToken int64              //Newest FrameTimeline token already counted
+
+	layerInfoLock    sync.Mutex
+	layerInfo        *SfLayerInfo //Buffer and composition information of the current surface
+	layerInfoSurface string       //Surface of the last full dump
+	layerInfoDumped  time.Time    //Last time of the full dump
 }
 
 func (t *SfLatencyStatPlugin) Run() {
@@ -76,14 +100,38 @@ func (t *SfLatencyStatPlugin) Run() {
 }
 
 func (t *SfLatencyStatPlugin) GetTypes() []*data.PluginType {
-	return []*data.PluginType{
+	types := []*data.PluginType{
 		{Name: "fps", DisplayName: "fps", IsCmdShow: true},
 		{Name: "jank", DisplayName: "jank", IsCmdShow: true},
 		{Name: "Bjank", DisplayName: "Bjank", IsCmdShow: true},
 		{Name: "jankTime", DisplayName: "jT(ms)", IsCmdShow: true},
 		{Name: "Sjank", DisplayName: "Sjank", IsCmdShow: true},
 		{Name: "jankPercent", DisplayName: "jT(%)", IsCmdShow: false},
+		{Name: "app_state", DisplayName: "state", IsCmdShow: false},
+		{Name: "pkg", DisplayName: "package", IsCmdShow: false},
+		{Name: "activity", DisplayName: "activity", IsCmdShow: false},
+	}
+	if data.GetCmdParameters().FrameTimeline {
+		types = append(types, getFrameTimelineTypes()...)
+	}
+	if data.GetCmdParameters().LayerInfo {
+		types = append(types, getSfLayerTypes()...)
 	}
+	return types
+}
+
+// IsSessionSample excludes the samples taken outside the foreground from session aggregates
+func (t *SfLatencyStatPlugin) IsSessionSample(itemData map[string]string) bool {
+	return itemData["app_state"] == AppStateForeground
+}
+
+// GetSegment segments the session aggregates by the resumed activity of the monitored application,
+// the samples taken outside the foreground are segmented by the application state, e.g. background
+func (t *SfLatencyStatPlugin) GetSegment(itemData map[string]string) string {
+	if state := itemData["app_state"]; state != AppStateForeground {
+		return state
+	}
+	return itemData["activity"]
 }
 
 func (t *SfLatencyStatPlugin) GetData() map[string]string {
@@ -112,12 +160,74 @@ func (t *SfLatencyStatPlugin) GetData() map[string]string {
 		"Sjank":       fmt.Sprintf("%d", secData.SmallJank),
 		"jankTime":    fmt.Sprintf("%d", secData.JankTotalTs/1000000),
 		"jankPercent": fmt.Sprintf("%.1f", jankPercent),
+		"app_state":   t.appState,
+		"pkg":         t.currentPkgName,
+		"activity":    t.topActivity,
+	}
+	if data.GetCmdParameters().FrameTimeline {
+		t.frameTimelineLock.Lock()
+		if t.frameTimelineData == nil {
+			t.frameTimelineData = NewFrameTimelineData()
+		}
+		t.frameTimelineData.outputData(ret)
+		t.frameTimelineData = NewFrameTimelineData()
+		t.frameTimelineLock.Unlock()
+	}
+	if data.GetCmdParameters().LayerInfo {
+		t.layerInfoLock.Lock()
+		layerInfo := t.layerInfo
+		if layerInfo == nil {
+			layerInfo = new(SfLayerInfo)
+		}
+		layerInfo.outputData(ret)
+		t.layerInfoLock.Unlock()
 	}
 	t.secOuputFrameData = &OutputFrameData{}
 	t.lastFpsTimestamp = t.prevPresentTs
 	return ret
 }
 
+// layerInfoDumpInterval is the interval of the full dump of SurfaceFlinger for the buffer information,
+// the full dump is large and blocks the main thread of SurfaceFlinger while it is taken
+const layerInfoDumpInterval = 10 * time.Second
+
+// getLayerInfoCommand returns the dump of the layer information, "" if nothing is dumped this time:
+//   - the full dump when the surface is changed, and every layerInfoDumpInterval for the buffer changes
+//   - the HWC layers table alone for the composition type between them, it can be dumped alone since android 13
+func (t *SfLatencyStatPlugin) getLayerInfoCommand(surfaceView string, now time.Time) string {
+	if surfaceView != t.layerInfoSurface || now.Sub(t.layerInfoDumped) >= layerInfoDumpInterval {
+		t.layerInfoSurface, t.layerInfoDumped = surfaceView, now
+		return "dumpsys SurfaceFlinger"
+	}
+	if t.sdkVersion >= 33 {
+		return "dumpsys SurfaceFlinger --hwclayers"
+	}
+	return ""
+}
+
+// updateLayerInfo saves the layer information and records the changes as events, the last values are
+// kept if the layer is missing in the dump or the dump failed
+func (t *SfLatencyStatPlugin) updateLayerInfo(layerInfo *SfLayerInfo) {
+	t.layerInfoLock.Lock()
+	defer t.layerInfoLock.Unlock()
+	if t.layerInfo != nil {
+		t.RecordChangeEvent("resolution_changed", t.layerInfo.BufferSize, layerInfo.BufferSize)
+		t.RecordChangeEvent("format_changed", t.layerInfo.BufferFormat, layerInfo.BufferFormat)
+		t.RecordChangeEvent("dataspace_changed", t.layerInfo.Dataspace, layerInfo.Dataspace)
+		t.RecordChangeEvent("composition_changed", t.layerInfo.Composition, layerInfo.Composition)
+		keepLastValue := func(value *string, last string) {
+			if *value == "" {
+				*value = last
+			}
+		}
+		keepLastValue(&layerInfo.BufferSize, t.layerInfo.BufferSize)
+		keepLastValue(&layerInfo.BufferFormat, t.layerInfo.BufferFormat)
+		keepLastValue(&layerInfo.Dataspace, t.layerInfo.Dataspace)
+		keepLastValue(&layerInfo.Composition, t.layerInfo.Composition)
+	}
+	t.layerInfo = layerInfo
+}
+
 func (t *SfLatencyStatPlugin) calcFrameTime(frameData *SfFrameData) {
 	//Calculate whether there is Jank
 	frameData = t.calcFrameJank(frameData)
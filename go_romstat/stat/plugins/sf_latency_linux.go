@@ -53,15 +53,17 @@ func (t *SfLatencyStatPlugin) GetCurrentPkgSurface() (string, string) {
 }
 func (t *SfLatencyStatPlugin) getLockedSurfaceView() (string, error) {
 	if t.lockedPkgSurface == nil {
-		pkgName := t.shell.GetTopmostPackage(t.sdkVersion)
+		pkgName := t.getTopPkgName()
 		t.debugLog.Println("topmost package: ", pkgName)
-		if (data.GetCmdParameters().PkgName != "") && pkgName != t.monitorProcessName {
-			return "", errors.New("process not match, monitor process name: " + t.monitorProcessName)
+		if !data.GetCmdParameters().MatchPackage(pkgName) {
+			return "", errors.New("process not match, monitor process name: " + data.GetCmdParameters().PkgName)
 		}
 		if t.lockedPkgSurface == nil {
 			t.lockedPkgSurface = new(SfPkgSurfaceData)
 		}
 		t.lockedPkgSurface.PkgName = pkgName
+		t.currentPkgName = pkgName
+		data.GetCmdParameters().SetForegroundPkgName(pkgName)
 		t.lockedPkgSurface.SurfaceView, _ = t.guessSurfaceView2(pkgName)
 	}
 	return t.lockedPkgSurface.SurfaceView, nil
@@ -199,28 +201,137 @@ func (t *SfLatencyStatPlugin) guessSurfaceView(pkgName string) (string, error) {
 	}
 	return "", errors.New("no surfaceview found")
 }
+func (t *SfLatencyStatPlugin) getTopPkgName() string {
+	return strings.Split(t.topActivity, "/")[0]
+}
+
+// refreshTopActivity updates the resumed activity and records every foreground switch as event
+func (t *SfLatencyStatPlugin) refreshTopActivity() {
+	t.topActivity = t.shell.GetTopmostActivity(t.sdkVersion)
+	if t.topActivity != "" && t.topActivity != t.switchActivity {
+		if t.switchActivity == "" {
+			t.RecordEvent("app_switch", t.topActivity)
+		} else {
+			t.RecordChangeEvent("app_switch", t.switchActivity, t.topActivity)
+		}
+		t.switchActivity = t.topActivity
+	}
+}
+
 func (t *SfLatencyStatPlugin) getTopSurfaceView() (string, error) {
-	pkgName := t.shell.GetTopmostPackage(t.sdkVersion)
+	pkgName := t.getTopPkgName()
 	t.debugLog.Println("topmost package: ", pkgName)
-	if (data.GetCmdParameters().PkgName != "") && pkgName != t.monitorProcessName {
-		return "", errors.New("process not match, monitor process name: " + t.monitorProcessName)
+	if !data.GetCmdParameters().MatchPackage(pkgName) {
+		return "", errors.New("process not match, monitor process name: " + data.GetCmdParameters().PkgName)
 	}
-	if t.currentPkgName != pkgName {
+	//The surface is guessed again when the activity changed, since the surfaces change with the activity
+	if t.currentPkgName != pkgName || t.surfaceActivity != t.topActivity {
 		t.currentPkgName = pkgName
+		t.surfaceActivity = t.topActivity
+		data.GetCmdParameters().SetForegroundPkgName(pkgName)
 		return t.guessSurfaceView2(pkgName)
 	}
 	return t.guessSurfaceView(pkgName)
 }
 
-func (t *SfLatencyStatPlugin) Open() bool {
-	if data.GetCmdParameters().PkgName != "" {
-		t.monitorProcessName = data.GetCmdParameters().PkgName
+// refreshAppState updates the state of the monitored application at most once per second
+//   - not-running: the monitored package has no running process
+//   - screen-off: the device is not awake
+//   - background: another package holds the resumed activity
+//   - unknown: the screen state or the resumed activity is not dumped
+func (t *SfLatencyStatPlugin) refreshAppState() {
+	if time.Since(t.appStateUpdated) < time.Second {
+		return
+	}
+	t.appStateUpdated = time.Now()
+	isMonitorPkg := len(data.GetCmdParameters().GetPkgPatterns()) > 0
+	//the process of the packages given by globs is unknown until one of them is in foreground
+	if isMonitorPkg && data.GetCmdParameters().IsPkgResolved() && data.GetCmdParameters().GetPid() == 0 {
+		t.appState = AppStateNotRunning
+		return
+	}
+	switch t.shell.GetScreenState() {
+	case utils.ScreenStateUnknown:
+		t.appState = AppStateUnknown
+		return
+	case utils.ScreenStateOff:
+		t.appState = AppStateScreenOff
+		return
+	}
+	if isMonitorPkg && t.topActivity == "" {
+		t.appState = AppStateUnknown
+		return
+	}
+	if isMonitorPkg && !data.GetCmdParameters().MatchPackage(t.getTopPkgName()) {
+		t.appState = AppStateBackground
+		return
+	}
+	t.appState = AppStateForeground
+}
+
+// runFrameTimelineThread counts the FrameTimeline jank types of the current surface
+func (t *SfLatencyStatPlugin) runFrameTimelineThread() {
+	if t.currentSurfaceView == "" {
+		return
 	}
+	surfaceView, pkgName := t.currentSurfaceView, t.currentPkgName
+	output := t.shell.RunShell("dumpsys SurfaceFlinger --frametimeline -all")
+	isTargetLayer := func(layer string) bool {
+		return layer == surfaceView || strings.HasPrefix(layer, surfaceView)
+	}
+	//The layer name of the FrameTimeline may not be same as the 'SurfaceFlinger --list',
+	//the layers of the package are counted only if none of them matches the surface
+	if !HasFrameTimelineLayer(output, isTargetLayer) && pkgName != "" {
+		isTargetLayer = func(layer string) bool {
+			return strings.Contains(layer, pkgName)
+		}
+	}
+	timelineData, token := ParseFrameTimeline(output, isTargetLayer, t.frameTimelineToken)
+	t.frameTimelineToken = token
+	t.frameTimelineLock.Lock()
+	defer t.frameTimelineLock.Unlock()
+	if t.frameTimelineData == nil {
+		t.frameTimelineData = timelineData
+		return
+	}
+	t.frameTimelineData.Frames += timelineData.Frames
+	t.frameTimelineData.JankFrames += timelineData.JankFrames
+	for k, v := range timelineData.JankTypes {
+		t.frameTimelineData.JankTypes[k] += v
+	}
+}
+
+// runLayerInfoThread tracks the buffer size, format, dataspace and composition type of the current surface
+func (t *SfLatencyStatPlugin) runLayerInfoThread() {
+	surfaceView := t.currentSurfaceView
+	if surfaceView == "" {
+		return
+	}
+	command := t.getLayerInfoCommand(surfaceView, time.Now())
+	if command == "" {
+		return
+	}
+	t.updateLayerInfo(ParseSfLayerInfo(t.shell.RunShell(command), surfaceView))
+}
+
+func (t *SfLatencyStatPlugin) Open() bool {
 	t.shell = utils.NewAndroidShell()
 	t.sdkVersion = t.shell.GetSdkVersion()
 	t.secOuputFrameData = &OutputFrameData{}
+	t.appState = AppStateForeground
 	t.debugLog = utils.DebugLogger
 	t.debugLog.Println("---start---")
+	if data.GetCmdParameters().FrameTimeline {
+		if t.sdkVersion < 31 { //FrameTimeline is available since android 12
+			t.debugLog.Println("frametimeline is not supported, sdk version:", t.sdkVersion)
+		} else {
+			t.frameTimelineData = NewFrameTimelineData()
+			go utils.SetTimer(1, t.runFrameTimelineThread)
+		}
+	}
+	if data.GetCmdParameters().LayerInfo {
+		go utils.SetTimer(1, t.runLayerInfoThread)
+	}
 	return true
 }
 
@@ -250,7 +361,7 @@ func (t *SfLatencyStatPlugin) getSFLatencyData() [][]int64 {
 		ret = append(ret, vals)
 	}
 	if len(ret) == 0 { //If the above method does not get data, use 'gfxinfo framestats' to get data
-		if packageName := t.shell.GetTopmostPackage(t.sdkVersion); packageName != "" {
+		if packageName := t.getTopPkgName(); packageName != "" {
 			output := t.shell.RunShell(fmt.Sprintf("dumpsys gfxinfo %s framestats", packageName))
 			lines := strings.Split(output, "\n")
 			findTimestamps := false
@@ -323,6 +434,8 @@ func (t *SfLatencyStatPlugin) refreshSFLatencyData(SurfaceChanged bool) [][]int6
 
 func (t *SfLatencyStatPlugin) runCollectThread() {
 	var newSfLatencyDatas [][]int64
+	t.refreshTopActivity()
+	t.refreshAppState()
 	if !data.GetCmdParameters().LockSurface {
 		oldSurfaceView := t.currentSurfaceView
 		t.currentSurfaceView, _ = t.getTopSurfaceView()
@@ -49,3 +49,22 @@ func TestJankCount(t *testing.T) {
 		t.Errorf("ERROR: plugin.secOuputFrameData.BigJank=%d, expect 45", plugin.secOuputFrameData.BigJank)
 	}
 }
+
+func TestSfLatencySegment(t *testing.T) {
+	plugin := &SfLatencyStatPlugin{}
+	for _, v := range []struct {
+		state   string
+		expect  string
+		session bool
+	}{
+		{AppStateForeground, "com.haima.cloudgame/.GameActivity", true},
+		{AppStateBackground, AppStateBackground, false},
+		{AppStateScreenOff, AppStateScreenOff, false},
+		{AppStateUnknown, AppStateUnknown, false},
+	} {
+		itemData := map[string]string{"app_state": v.state, "activity": "com.haima.cloudgame/.GameActivity"}
+		if segment := plugin.GetSegment(itemData); segment != v.expect || plugin.IsSessionSample(itemData) != v.session {
+			t.Errorf("ERROR: %s segment=%s, expect %s", v.state, segment, v.expect)
+		}
+	}
+}
@@ -156,6 +156,7 @@ func (t *DesktopFramerateCoutner) Start() error {
 // For Windows Only
 func (t *SfLatencyStatPlugin) Open() bool {
 	t.secOuputFrameData = &OutputFrameData{}
+	t.appState = AppStateForeground
 	t.debugLog = utils.DebugLogger
 	t.debugLog.Println("---start---")
 	if t.d3dxLoopCounter == nil {
@@ -172,7 +173,7 @@ func (t *SfLatencyStatPlugin) Open() bool {
 			}
 		}
 	}()
-	return false
+	return true
 }
 
 func (t *SfLatencyStatPlugin) Close() {
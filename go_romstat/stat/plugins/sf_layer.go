@@ -0,0 +1,75 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+package plugins
+
+import (
+	"regexp"
+	"strings"
+
+	"romstat/stat/data"
+)
+
+// Buffer and composition information of a SurfaceFlinger layer
+type SfLayerInfo struct {
+	BufferSize   string //width x height of the active buffer
+	BufferFormat string //pixel format of the active buffer, e.g. RGBA_8888
+	Dataspace    string //dataspace of the layer, e.g. BT709 sRGB Full range
+	Composition  string //HWC composition type, e.g. DEVICE, CLIENT
+}
+
+var (
+	rActiveBuffer = regexp.MustCompile(`activeBuffer=\[\s*(\d+)\s*x\s*(\d+)\s*:\s*\d+\s*,\s*([^\]]+)\]`)
+	rDataspace    = regexp.MustCompile(`dataspace=([^,]+),`)
+	rComposition  = regexp.MustCompile(`\b(CLIENT|DEVICE|SOLID_COLOR|CURSOR|SIDEBAND|DISPLAY_DECORATION)\b`)
+)
+
+func getSfLayerTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "buf_size", DisplayName: "resolution", IsCmdShow: false},
+		{Name: "buf_format", DisplayName: "format", IsCmdShow: false},
+		{Name: "dataspace", DisplayName: "dataspace", IsCmdShow: false},
+		{Name: "composition", DisplayName: "composition", IsCmdShow: false},
+	}
+}
+
+func (t *SfLayerInfo) outputData(ret map[string]string) {
+	ret["buf_size"] = t.BufferSize
+	ret["buf_format"] = t.BufferFormat
+	ret["dataspace"] = t.Dataspace
+	ret["composition"] = t.Composition
+}
+
+// ParseSfLayerInfo parses the layer dump and the HWC layers table of 'dumpsys SurfaceFlinger'
+// for the layer named layerName
+func ParseSfLayerInfo(output string, layerName string) *SfLayerInfo {
+	ret := new(SfLayerInfo)
+	if layerName == "" {
+		return ret
+	}
+	lines := strings.Split(output, "\n")
+	inLayer := false
+	for idx, line := range lines {
+		//Layer dump, e.g. '+ BufferStateLayer (SurfaceView[...](BLAST)#312) uid=10123'
+		if strings.HasPrefix(line, "+ ") {
+			inLayer = strings.Contains(line, "("+layerName+")")
+			continue
+		}
+		if inLayer {
+			if sz := rActiveBuffer.FindStringSubmatch(line); len(sz) > 3 && ret.BufferSize == "" {
+				ret.BufferSize = sz[1] + "x" + sz[2]
+				ret.BufferFormat = strings.TrimSpace(sz[3])
+			}
+			if sz := rDataspace.FindStringSubmatch(line); len(sz) > 1 && ret.Dataspace == "" {
+				ret.Dataspace = strings.TrimSpace(sz[1])
+			}
+			continue
+		}
+		//HWC layers table, the composition type is in the row after the layer name
+		if strings.TrimSpace(line) == layerName && idx+1 < len(lines) && ret.Composition == "" {
+			if sz := rComposition.FindStringSubmatch(lines[idx+1]); len(sz) > 1 {
+				ret.Composition = sz[1]
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,116 @@
+package plugins
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"romstat/stat/data"
+)
+
+func TestParseSfLayerInfo(t *testing.T) {
+	output, err := os.ReadFile("testdata/sf_layers_android13.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerInfo := ParseSfLayerInfo(string(output), "SurfaceView[com.example.game/com.example.game.MainActivity](BLAST)#312")
+	expect := SfLayerInfo{BufferSize: "1600x720", BufferFormat: "RGBX_8888", Dataspace: "Default", Composition: "DEVICE"}
+	if *layerInfo != expect {
+		t.Errorf("ERROR: layerInfo=%+v, expect %+v", *layerInfo, expect)
+	}
+	layerInfo = ParseSfLayerInfo(string(output), "StatusBar#75")
+	expect = SfLayerInfo{BufferSize: "2400x80", BufferFormat: "RGBA_8888", Dataspace: "BT709 sRGB Full range", Composition: "CLIENT"}
+	if *layerInfo != expect {
+		t.Errorf("ERROR: layerInfo=%+v, expect %+v", *layerInfo, expect)
+	}
+}
+
+func TestLayerInfoChangeEvents(t *testing.T) {
+	plugin := &SfLatencyStatPlugin{}
+	plugin.updateLayerInfo(&SfLayerInfo{BufferSize: "1600x720", Composition: "DEVICE"})
+	plugin.updateLayerInfo(&SfLayerInfo{BufferSize: "1600x720", Composition: "DEVICE"})
+	plugin.updateLayerInfo(&SfLayerInfo{BufferSize: "1280x576", Composition: "CLIENT"})
+	events := plugin.GetEvents()
+	if len(events) != 2 {
+		t.Fatalf("ERROR: len(events)=%d, expect 2", len(events))
+	}
+	if events[0].Name != "resolution_changed" || events[0].Detail != "1600x720 -> 1280x576" {
+		t.Errorf("ERROR: events[0]=%+v", *events[0])
+	}
+	if len(plugin.GetEvents()) != 0 {
+		t.Errorf("ERROR: events should be cleared after GetEvents")
+	}
+
+	//the failed dump keeps the last values, the change after it is still recorded
+	plugin.updateLayerInfo(ParseSfLayerInfo("", "SurfaceView[com.haima.cloudgame/.GameActivity](BLAST)#312"))
+	plugin.updateLayerInfo(&SfLayerInfo{BufferSize: "1600x720", Composition: "CLIENT"})
+	events = plugin.GetEvents()
+	if len(events) != 1 || events[0].Detail != "1280x576 -> 1600x720" {
+		t.Errorf("ERROR: events=%v, expect only the resolution change after the failed dump", events)
+	}
+}
+
+func TestLayerInfoCommand(t *testing.T) {
+	plugin := &SfLatencyStatPlugin{sdkVersion: 33}
+	now := time.Now()
+	surfaceView := "SurfaceView[com.example.game/com.example.game.MainActivity](BLAST)#312"
+	for _, v := range []struct {
+		surfaceView string
+		elapsed     time.Duration
+		expect      string
+	}{
+		{surfaceView, 0, "dumpsys SurfaceFlinger"},
+		{surfaceView, time.Second, "dumpsys SurfaceFlinger --hwclayers"},
+		{"StatusBar#75", 2 * time.Second, "dumpsys SurfaceFlinger"},
+		{"StatusBar#75", 11 * time.Second, "dumpsys SurfaceFlinger --hwclayers"},
+		{"StatusBar#75", 12 * time.Second, "dumpsys SurfaceFlinger"},
+	} {
+		if ret := plugin.getLayerInfoCommand(v.surfaceView, now.Add(v.elapsed)); ret != v.expect {
+			t.Errorf("ERROR: %s +%v command=%s, expect %s", v.surfaceView, v.elapsed, ret, v.expect)
+		}
+	}
+	plugin = &SfLatencyStatPlugin{sdkVersion: 30}
+	plugin.getLayerInfoCommand(surfaceView, now)
+	if ret := plugin.getLayerInfoCommand(surfaceView, now.Add(time.Second)); ret != "" {
+		t.Errorf("ERROR: command=%s, expect no dump between the full dumps before android 13", ret)
+	}
+
+	//the HWC layers table only updates the composition
+	output, err := os.ReadFile("testdata/sf_layers_android13.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hwcLayers := string(output)[:strings.Index(string(output), "Visible layers")]
+	plugin.updateLayerInfo(ParseSfLayerInfo(string(output), surfaceView))
+	plugin.updateLayerInfo(ParseSfLayerInfo(strings.Replace(hwcLayers, "DEVICE", "CLIENT", 1), surfaceView))
+	expect := SfLayerInfo{BufferSize: "1600x720", BufferFormat: "RGBX_8888", Dataspace: "Default", Composition: "CLIENT"}
+	if *plugin.layerInfo != expect {
+		t.Errorf("ERROR: layerInfo=%+v, expect %+v", *plugin.layerInfo, expect)
+	}
+}
+
+func TestLayerInfoConcurrentGetData(t *testing.T) {
+	params := data.GetCmdParameters()
+	defer func(layerInfo bool) { params.LayerInfo = layerInfo }(params.LayerInfo)
+	params.LayerInfo = true
+	plugin := &SfLatencyStatPlugin{secOuputFrameData: &OutputFrameData{}}
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			plugin.updateLayerInfo(&SfLayerInfo{BufferSize: "1600x720", Composition: "DEVICE"})
+		}
+		close(done)
+	}()
+	for isDone := false; !isDone; {
+		select {
+		case <-done:
+			isDone = true
+		default:
+			plugin.GetData()
+		}
+	}
+	if ret := plugin.GetData(); ret["buf_size"] != "1600x720" {
+		t.Errorf("ERROR: buf_size=%s, expect 1600x720", ret["buf_size"])
+	}
+}
@@ -38,16 +38,44 @@ func (c *SystemStatPlugin) Open() bool {
 	return true
 }
 
+// sumProcessCpuTime returns the cpu seconds of the processes, the exited processes are skipped
+func sumProcessCpuTime(pids []int32) map[int32]float64 {
+	ret := make(map[int32]float64)
+	for _, pid := range pids {
+		ps, err := process.NewProcess(pid)
+		if err != nil {
+			continue
+		}
+		times, err := ps.Times()
+		if err != nil {
+			continue
+		}
+		ret[pid] = times.User + times.System
+	}
+	return ret
+}
+
 func (c *SystemStatPlugin) cpuStat() {
 	for {
-		if pid := data.GetCmdParameters().GetPid(); pid != 0 {
-			ps, _ := process.NewProcess(pid)
-			percent, err := ps.Percent(c.collectSecTime)
-			if err != nil {
-				panic("cpu collect error")
+		if pids := data.GetCmdParameters().GetPids(); len(pids) > 0 {
+			//usage of all processes of the package uid, a process started in the interval is counted from the next one
+			startTime := time.Now()
+			lastCpuTimes := sumProcessCpuTime(pids)
+			time.Sleep(c.collectSecTime)
+			cpuTimes := sumProcessCpuTime(pids)
+			elapsed := time.Since(startTime).Seconds()
+			var busy float64
+			for pid, cpuTime := range cpuTimes {
+				if lastCpuTime, ok := lastCpuTimes[pid]; ok && cpuTime >= lastCpuTime {
+					busy += cpuTime - lastCpuTime
+				}
 			}
-			cpuUsagePercent := percent / float64(runtime.NumCPU())
+			cpuUsagePercent := busy * 100 / elapsed / float64(runtime.NumCPU())
 			c.cpuUsageCh <- cpuUsagePercent
+		} else if !data.GetCmdParameters().IsPkgResolved() {
+			//the columns are of the app, the device is not measured instead
+			time.Sleep(c.collectSecTime)
+			c.cpuUsageCh <- 0
 		} else {
 			percent, err := cpu.Percent(c.collectSecTime, false)
 			if err != nil {
@@ -60,18 +88,28 @@ func (c *SystemStatPlugin) cpuStat() {
 
 func (c *SystemStatPlugin) memStat() {
 	for {
-		if pid := data.GetCmdParameters().GetPid(); pid != 0 {
-			ps, _ := process.NewProcess(pid)
-			memPercent, _ := ps.MemoryPercent()
-			memInfo, err := ps.MemoryInfo()
-			if err != nil {
-				panic("memory collect error")
+		if pids := data.GetCmdParameters().GetPids(); len(pids) > 0 {
+			memStatData := new(MemoryStatData)
+			for _, pid := range pids {
+				ps, err := process.NewProcess(pid)
+				if err != nil {
+					continue
+				}
+				memPercent, _ := ps.MemoryPercent()
+				memInfo, err := ps.MemoryInfo()
+				if err != nil {
+					continue
+				}
+				//the percent is of RSS, the shared pages like the zygote preloads are counted in every process,
+				//so the sum is an upper bound, the memory plugin reports PSS
+				memStatData.UsedPercent += float64(memPercent)
+				memStatData.SwapCached += memInfo.Swap
 			}
 			time.Sleep(c.collectSecTime)
-			c.memInfoCh <- &MemoryStatData{
-				UsedPercent: float64(memPercent),
-				SwapCached:  memInfo.Swap,
-			}
+			c.memInfoCh <- memStatData
+		} else if !data.GetCmdParameters().IsPkgResolved() {
+			time.Sleep(c.collectSecTime)
+			c.memInfoCh <- new(MemoryStatData)
 		} else {
 			memInfo, err := mem.VirtualMemory()
 			if err != nil {
@@ -112,6 +150,9 @@ func (c *SystemStatPlugin) GetTypes() []*data.PluginType {
 
 func (c *SystemStatPlugin) GetData() map[string]string {
 	c.collectSecTime = time.Second
+	if !data.GetCmdParameters().IsPkgResolved() {
+		return map[string]string{"cpu_usg": "", "mem_usg": "", "mem_swap": ""}
+	}
 	return map[string]string{
 		"cpu_usg":  fmt.Sprintf("%.1f", c.cpuUsage),
 		"mem_usg":  fmt.Sprintf("%.1f", c.memPercent),
@@ -0,0 +1,306 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// States of /proc/net/tcp, include/net/tcp_states.h
+const (
+	tcpEstablished = 1
+)
+
+type ProcNetSocket struct {
+	State int
+	Uid   int32
+}
+
+// ParseProcNetSockets parses /proc/net/tcp, tcp6, udp or udp6, a line is
+// 'sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...'
+func ParseProcNetSockets(content string) []*ProcNetSocket {
+	ret := make([]*ProcNetSocket, 0)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		state, err1 := strconv.ParseInt(fields[3], 16, 32)
+		uid, err2 := strconv.ParseInt(fields[7], 10, 32)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		ret = append(ret, &ProcNetSocket{State: int(state), Uid: int32(uid)})
+	}
+	return ret
+}
+
+// TcpConnInfo is a tcp connection of 'ss -tine', the times are in milliseconds
+type TcpConnInfo struct {
+	Local         string
+	Peer          string
+	Uid           int32
+	Rtt           float64 //smoothed round trip time
+	RttVar        float64
+	Cwnd          int64 //congestion window in segments
+	Retrans       int64 //total retransmitted segments
+	BytesAcked    int64
+	BytesReceived int64
+}
+
+func (t *TcpConnInfo) key() string {
+	return t.Local + "-" + t.Peer
+}
+
+func (t *TcpConnInfo) parseInfo(fields []string) {
+	for _, field := range fields {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "rtt":
+			//rtt:<srtt>/<rttvar>
+			rtt := strings.SplitN(kv[1], "/", 2)
+			t.Rtt, _ = strconv.ParseFloat(rtt[0], 64)
+			if len(rtt) == 2 {
+				t.RttVar, _ = strconv.ParseFloat(rtt[1], 64)
+			}
+		case "cwnd":
+			t.Cwnd, _ = strconv.ParseInt(kv[1], 10, 64)
+		case "retrans":
+			//retrans:<unacked retransmits>/<total retransmits>
+			retrans := strings.SplitN(kv[1], "/", 2)
+			t.Retrans, _ = strconv.ParseInt(retrans[len(retrans)-1], 10, 64)
+		case "bytes_acked":
+			t.BytesAcked, _ = strconv.ParseInt(kv[1], 10, 64)
+		case "bytes_received":
+			t.BytesReceived, _ = strconv.ParseInt(kv[1], 10, 64)
+		}
+	}
+}
+
+// ParseSsTcpInfo parses the established connections of 'ss -tine', the socket line is followed by
+// the indented tcp_info line
+func ParseSsTcpInfo(output string) []*TcpConnInfo {
+	ret := make([]*TcpConnInfo, 0)
+	var current *TcpConnInfo
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if current != nil {
+				current.parseInfo(fields)
+			}
+			continue
+		}
+		current = nil
+		if fields[0] != "ESTAB" || len(fields) < 5 {
+			continue
+		}
+		current = &TcpConnInfo{Local: fields[3], Peer: fields[4], Uid: -1}
+		for _, field := range fields[5:] {
+			if strings.HasPrefix(field, "uid:") {
+				if uid, err := strconv.ParseInt(strings.TrimPrefix(field, "uid:"), 10, 32); err == nil {
+					current.Uid = int32(uid)
+				}
+			}
+		}
+		current.parseInfo(fields[5:])
+		ret = append(ret, current)
+	}
+	return ret
+}
+
+// ParseSnmp parses a protocol of /proc/net/snmp, the protocol has a line of names followed by a line of values
+func ParseSnmp(content string, protocol string) map[string]int64 {
+	ret := make(map[string]int64)
+	var names []string
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != protocol+":" {
+			continue
+		}
+		if names == nil {
+			names = fields[1:]
+			continue
+		}
+		for idx, value := range fields[1:] {
+			if idx >= len(names) {
+				break
+			}
+			if val, err := strconv.ParseInt(value, 10, 64); err == nil {
+				ret[names[idx]] = val
+			}
+		}
+		break
+	}
+	return ret
+}
+
+type TcpStatPlugin struct {
+	procPath string //root of the procfs, /proc
+	shell    *utils.AndroidShell
+	hasSs    bool
+
+	lastSnmp      map[string]int64
+	lastConnBytes map[string]int64 //bytes of every connection of the target uid
+	lastRetrans   map[string]int64
+
+	tcpConns       int
+	udpSockets     int
+	hasUid         bool
+	topConn        *TcpConnInfo
+	topRetrans     int64 //retransmitted segments of the busiest connection in the last interval
+	retransRate    float64
+	hasRetransRate bool
+}
+
+func (t *TcpStatPlugin) Open() bool {
+	if t.procPath == "" {
+		t.procPath = "/proc"
+	}
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	//ss of iproute2 is shipped with most android versions, the per connection details are skipped without it
+	t.hasSs = strings.Contains(t.shell.RunShell("ss -V"), "iproute2")
+	t.lastConnBytes = make(map[string]int64)
+	t.lastRetrans = make(map[string]int64)
+	return true
+}
+
+func (t *TcpStatPlugin) Close() {
+}
+
+func (t *TcpStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectTcpStat)
+}
+
+func (t *TcpStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "tcp_conns", DisplayName: "tcpConns", IsCmdShow: true},
+		{Name: "udp_sockets", DisplayName: "udpSocks", IsCmdShow: false},
+		{Name: "tcp_top_peer", DisplayName: "topPeer", IsCmdShow: false},
+		{Name: "tcp_top_rtt", DisplayName: "topRtt(ms)", IsCmdShow: true},
+		{Name: "tcp_top_rttvar", DisplayName: "topRttVar(ms)", IsCmdShow: false},
+		{Name: "tcp_top_cwnd", DisplayName: "topCwnd", IsCmdShow: false},
+		{Name: "tcp_top_retrans", DisplayName: "topRetrans", IsCmdShow: true},
+		{Name: "tcp_retrans_rate", DisplayName: "retrans%", IsCmdShow: true},
+	}
+}
+
+// countSockets counts the established tcp connections and the udp sockets of the uid
+func (t *TcpStatPlugin) countSockets(uid int32) (int, int) {
+	var tcpConns, udpSockets int
+	for _, name := range []string{"tcp", "tcp6"} {
+		for _, socket := range ParseProcNetSockets(utils.ReadFileString(filepath.Join(t.procPath, "net", name))) {
+			if socket.Uid == uid && socket.State == tcpEstablished {
+				tcpConns += 1
+			}
+		}
+	}
+	for _, name := range []string{"udp", "udp6"} {
+		for _, socket := range ParseProcNetSockets(utils.ReadFileString(filepath.Join(t.procPath, "net", name))) {
+			if socket.Uid == uid {
+				udpSockets += 1
+			}
+		}
+	}
+	return tcpConns, udpSockets
+}
+
+// collectTopConn finds the connection of the uid which transferred the most bytes in the last interval
+func (t *TcpStatPlugin) collectTopConn(uid int32) {
+	connBytes := make(map[string]int64)
+	retrans := make(map[string]int64)
+	var topConn *TcpConnInfo
+	var topBytes int64 = -1
+	for _, conn := range ParseSsTcpInfo(t.shell.RunShell("ss -tine")) {
+		if conn.Uid != uid {
+			continue
+		}
+		key := conn.key()
+		connBytes[key] = conn.BytesAcked + conn.BytesReceived
+		retrans[key] = conn.Retrans
+		bytes := connBytes[key]
+		if last, ok := t.lastConnBytes[key]; ok && bytes >= last {
+			bytes -= last
+		}
+		if bytes > topBytes {
+			topConn, topBytes = conn, bytes
+		}
+	}
+	t.topRetrans = 0
+	if topConn != nil {
+		if last, ok := t.lastRetrans[topConn.key()]; ok && topConn.Retrans >= last {
+			t.topRetrans = topConn.Retrans - last
+		}
+	}
+	t.topConn, t.lastConnBytes, t.lastRetrans = topConn, connBytes, retrans
+}
+
+func (t *TcpStatPlugin) collectTcpStat() {
+	//retransmitted segments of all tcp segments sent by the device
+	snmp := ParseSnmp(utils.ReadFileString(filepath.Join(t.procPath, "net/snmp")), "Tcp")
+	t.retransRate, t.hasRetransRate = 0, false
+	if last := t.lastSnmp; last != nil {
+		outSegs := snmp["OutSegs"] - last["OutSegs"]
+		if outSegs > 0 && snmp["RetransSegs"] >= last["RetransSegs"] {
+			t.retransRate = float64(snmp["RetransSegs"]-last["RetransSegs"]) * 100 / float64(outSegs)
+		}
+		t.hasRetransRate = true
+	}
+	t.lastSnmp = snmp
+
+	uid, ok := data.GetCmdParameters().GetUid()
+	t.hasUid = ok
+	if !ok {
+		t.tcpConns, t.udpSockets, t.topConn = 0, 0, nil
+		return
+	}
+	t.tcpConns, t.udpSockets = t.countSockets(uid)
+	if t.hasSs {
+		t.collectTopConn(uid)
+	}
+}
+
+func (t *TcpStatPlugin) GetData() map[string]string {
+	ret := map[string]string{
+		"tcp_conns":        "",
+		"udp_sockets":      "",
+		"tcp_top_peer":     "",
+		"tcp_top_rtt":      "",
+		"tcp_top_rttvar":   "",
+		"tcp_top_cwnd":     "",
+		"tcp_top_retrans":  "",
+		"tcp_retrans_rate": "",
+	}
+	if t.hasRetransRate {
+		ret["tcp_retrans_rate"] = fmt.Sprintf("%.2f", t.retransRate)
+	}
+	if !data.GetCmdParameters().IsPkgResolved() {
+		return ret
+	}
+	if t.hasUid {
+		ret["tcp_conns"] = strconv.Itoa(t.tcpConns)
+		ret["udp_sockets"] = strconv.Itoa(t.udpSockets)
+	}
+	if topConn := t.topConn; topConn != nil {
+		ret["tcp_top_peer"] = topConn.Peer
+		ret["tcp_top_rtt"] = fmt.Sprintf("%.1f", topConn.Rtt)
+		ret["tcp_top_rttvar"] = fmt.Sprintf("%.1f", topConn.RttVar)
+		ret["tcp_top_cwnd"] = strconv.FormatInt(topConn.Cwnd, 10)
+		ret["tcp_top_retrans"] = strconv.FormatInt(t.topRetrans, 10)
+	}
+	return ret
+}
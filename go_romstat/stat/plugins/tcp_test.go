@@ -0,0 +1,69 @@
+package plugins
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseProcNetSockets(t *testing.T) {
+	content := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 0100007F:9C5D 00000000:0000 0A 00000000:00000000 00:00000000 00000000  2000        0 41523 1 0000000000000000 100 0 0 10 0\n" +
+		"   1: 0501A8C0:A892 0971007B:01BB 01 00000000:00000000 02:000A3A26 00000000 10123        0 512311 2 0000000000000000 21 4 30 10 -1\n" +
+		"   2: 0501A8C0:A896 0971007B:01BB 06 00000000:00000000 03:00001595 00000000     0        0 0 3 0000000000000000\n"
+	sockets := ParseProcNetSockets(content)
+	if len(sockets) != 3 {
+		t.Fatalf("ERROR: sockets=%d, expect 3", len(sockets))
+	}
+	if sockets[1].State != tcpEstablished || sockets[1].Uid != 10123 || sockets[0].State != 0x0A {
+		t.Errorf("ERROR: sockets=%+v %+v", *sockets[0], *sockets[1])
+	}
+}
+
+func TestParseSsTcpInfo(t *testing.T) {
+	output := "State  Recv-Q Send-Q   Local Address:Port     Peer Address:Port Process\n" +
+		"ESTAB  0      0      192.168.1.5:43122   203.0.113.9:443   uid:10123 ino:512311 sk:1 <->\n" +
+		"\t cubic wscale:7,7 rto:216 rtt:15.2/4.1 ato:40 mss:1448 pmtu:1500 rcvmss:1448 advmss:1448 cwnd:24 ssthresh:18 bytes_sent:91211 bytes_retrans:2896 bytes_acked:88316 bytes_received:8812311 segs_out:900 segs_in:6200 send 18.3Mbps retrans:0/2 rcv_space:14600 minrtt:10.1\n" +
+		"ESTAB  0      0      [::ffff:192.168.1.5]:50110   [::ffff:198.51.100.7]:8080   uid:1000 ino:1111 sk:2 <->\n" +
+		"\t cubic rtt:1.5/0.7 cwnd:10 bytes_acked:100 bytes_received:200\n" +
+		"SYN-SENT 0   1      192.168.1.5:43200   203.0.113.10:443  uid:10123 ino:0 sk:3 <->\n" +
+		"\t cubic rto:1000 mss:524 cwnd:1\n"
+	conns := ParseSsTcpInfo(output)
+	if len(conns) != 2 {
+		t.Fatalf("ERROR: conns=%d, expect 2", len(conns))
+	}
+	expect := TcpConnInfo{Local: "192.168.1.5:43122", Peer: "203.0.113.9:443", Uid: 10123, Rtt: 15.2, RttVar: 4.1,
+		Cwnd: 24, Retrans: 2, BytesAcked: 88316, BytesReceived: 8812311}
+	if *conns[0] != expect {
+		t.Errorf("ERROR: conn=%+v, expect %+v", *conns[0], expect)
+	}
+	if conns[1].Uid != 1000 || conns[1].Peer != "[::ffff:198.51.100.7]:8080" {
+		t.Errorf("ERROR: conn=%+v", *conns[1])
+	}
+}
+
+func TestTcpRetransRate(t *testing.T) {
+	root := t.TempDir()
+	snmp := "Ip: Forwarding DefaultTTL\nIp: 2 64\n" +
+		"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors\n" +
+		"Tcp: 1 200 120000 -1 %d 0 0 0 5 100000 %d %d 0 10 0\n"
+	writeFakeFile(t, root, "net/snmp", fmt.Sprintf(snmp, 100, 50000, 200))
+	plugin := &TcpStatPlugin{procPath: root}
+	plugin.collectTcpStat()
+	if ret := plugin.GetData(); ret["tcp_retrans_rate"] != "" {
+		t.Errorf("ERROR: tcp_retrans_rate=%s, expect empty for the first sample", ret["tcp_retrans_rate"])
+	}
+	writeFakeFile(t, root, "net/snmp", fmt.Sprintf(snmp, 110, 52000, 230))
+	plugin.collectTcpStat()
+	if ret := plugin.GetData(); ret["tcp_retrans_rate"] != "1.50" {
+		t.Errorf("ERROR: tcp_retrans_rate=%s, expect 1.50", ret["tcp_retrans_rate"])
+	}
+
+	plugin.hasUid, plugin.tcpConns, plugin.topConn = true, 3, &TcpConnInfo{Peer: "10.0.0.1:443", Rtt: 20}
+	if ret := plugin.GetData(); ret["tcp_conns"] != "3" || ret["tcp_top_peer"] != "10.0.0.1:443" {
+		t.Errorf("ERROR: data=%v, expect the connections of the app", ret)
+	}
+	setUnresolvedPackage(t)
+	if ret := plugin.GetData(); ret["tcp_conns"] != "" || ret["tcp_top_peer"] != "" || ret["tcp_retrans_rate"] != "1.50" {
+		t.Errorf("ERROR: data=%v, expect empty app columns before the package is resolved", ret)
+	}
+}
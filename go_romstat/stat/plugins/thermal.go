@@ -0,0 +1,219 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+// Thermal status of android PowerManager
+var thermalStatusNames = []string{"NONE", "LIGHT", "MODERATE", "SEVERE", "CRITICAL", "EMERGENCY", "SHUTDOWN"}
+
+// Sensor groups of the thermal zones, a zone belongs to the group if its type contains any keyword
+var thermalSensorGroups = []struct {
+	Name     string
+	Keywords []string
+}{
+	{Name: "cpu", Keywords: []string{"cpu", "big", "little", "mid"}},
+	{Name: "gpu", Keywords: []string{"gpu"}},
+	{Name: "battery", Keywords: []string{"battery", "bms"}},
+	{Name: "skin", Keywords: []string{"skin", "shell", "quiet"}},
+}
+
+var rThermalStatus = regexp.MustCompile(`Thermal Status:\s*(\d+)`)
+
+type ThermalZone struct {
+	Type string
+	Path string
+}
+
+type CoolingDevice struct {
+	Type      string
+	Path      string
+	MaxState  int64
+	BaseState int64 //cur_state at Open, many SoCs keep some devices above 0 all the time
+}
+
+// ThermalServiceStatus is the status of 'dumpsys thermalservice', the thermal headroom is not dumped,
+// it is only available by PowerManager.getThermalHeadroom of the application
+type ThermalServiceStatus struct {
+	Status int //thermal status, -1 if not available
+}
+
+// ParseThermalService parses the output of 'dumpsys thermalservice'
+func ParseThermalService(output string) *ThermalServiceStatus {
+	ret := &ThermalServiceStatus{Status: -1}
+	if sz := rThermalStatus.FindStringSubmatch(output); len(sz) > 1 {
+		ret.Status, _ = strconv.Atoi(sz[1])
+	}
+	return ret
+}
+
+// normalizeTemperature converts the millidegree celsius of thermal zone to degree celsius
+func normalizeTemperature(temp int64) float64 {
+	if temp > 1000 || temp < -1000 {
+		return float64(temp) / 1000
+	}
+	return float64(temp)
+}
+
+type ThermalStatPlugin struct {
+	EventRecorder
+
+	sysRoot  string //root of the sysfs, '/' for the device
+	shell    *utils.AndroidShell
+	zones    []*ThermalZone
+	coolings []*CoolingDevice
+
+	temperatures  map[string]float64 //the max temperature of every sensor group
+	status        *ThermalServiceStatus
+	activeCooling []string //cooling devices with a state above 0, e.g. thermal-cpufreq-7:3/20
+	isThrottling  bool
+}
+
+func (t *ThermalStatPlugin) Open() bool {
+	if t.sysRoot == "" {
+		t.sysRoot = "/"
+	}
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	t.zones = make([]*ThermalZone, 0)
+	zonePaths, _ := filepath.Glob(filepath.Join(t.sysRoot, "sys/class/thermal/thermal_zone*"))
+	for _, zonePath := range zonePaths {
+		t.zones = append(t.zones, &ThermalZone{Type: utils.ReadFileString(filepath.Join(zonePath, "type")), Path: zonePath})
+	}
+	t.coolings = make([]*CoolingDevice, 0)
+	coolingPaths, _ := filepath.Glob(filepath.Join(t.sysRoot, "sys/class/thermal/cooling_device*"))
+	for _, coolingPath := range coolingPaths {
+		maxState, _ := utils.ReadFileInt(filepath.Join(coolingPath, "max_state"))
+		baseState, _ := utils.ReadFileInt(filepath.Join(coolingPath, "cur_state"))
+		t.coolings = append(t.coolings, &CoolingDevice{
+			Type:      utils.ReadFileString(filepath.Join(coolingPath, "type")),
+			Path:      coolingPath,
+			MaxState:  maxState,
+			BaseState: baseState,
+		})
+	}
+	t.temperatures = make(map[string]float64)
+	t.status = &ThermalServiceStatus{Status: -1}
+	return len(t.zones) > 0
+}
+
+func (t *ThermalStatPlugin) Close() {
+}
+
+func (t *ThermalStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectThermalStat)
+}
+
+func (t *ThermalStatPlugin) GetTypes() []*data.PluginType {
+	types := make([]*data.PluginType, 0)
+	for _, group := range thermalSensorGroups {
+		types = append(types, &data.PluginType{Name: "temp_" + group.Name, DisplayName: group.Name + "(C)", IsCmdShow: true})
+	}
+	return append(types,
+		&data.PluginType{Name: "thermal_status", DisplayName: "tStatus", IsCmdShow: true},
+		&data.PluginType{Name: "cooling_active", DisplayName: "cooling", IsCmdShow: false},
+		&data.PluginType{Name: "cooling_devices", DisplayName: "coolingDevices", IsCmdShow: false},
+		&data.PluginType{Name: "throttling", DisplayName: "throttling", IsCmdShow: false},
+	)
+}
+
+func (t *ThermalStatPlugin) collectThermalStat() {
+	t.update(ParseThermalService(t.shell.RunShell("dumpsys thermalservice")))
+}
+
+// update reads the thermal zones and the cooling devices, the columns report the absolute state of the cooling devices,
+// the throttling is detected by the thermal status or the cooling devices raised above their state at Open
+func (t *ThermalStatPlugin) update(status *ThermalServiceStatus) {
+	temperatures := make(map[string]float64)
+	for _, zone := range t.zones {
+		temp, err := utils.ReadFileInt(filepath.Join(zone.Path, "temp"))
+		if err != nil {
+			continue
+		}
+		zoneType := strings.ToLower(zone.Type)
+		for _, group := range thermalSensorGroups {
+			for _, keyword := range group.Keywords {
+				if !strings.Contains(zoneType, keyword) {
+					continue
+				}
+				if last, ok := temperatures[group.Name]; !ok || normalizeTemperature(temp) > last {
+					temperatures[group.Name] = normalizeTemperature(temp)
+				}
+				break
+			}
+		}
+	}
+
+	activeCooling, raisedCooling := make([]string, 0), make([]string, 0)
+	for _, cooling := range t.coolings {
+		curState, err := utils.ReadFileInt(filepath.Join(cooling.Path, "cur_state"))
+		if err != nil || curState <= 0 {
+			continue
+		}
+		state := fmt.Sprintf("%s:%d/%d", cooling.Type, curState, cooling.MaxState)
+		activeCooling = append(activeCooling, state)
+		if curState > cooling.BaseState {
+			raisedCooling = append(raisedCooling, state)
+		}
+	}
+	sort.Strings(activeCooling)
+	sort.Strings(raisedCooling)
+
+	isThrottling := status.Status >= 1 || len(raisedCooling) > 0
+	if isThrottling && !t.isThrottling {
+		t.RecordEvent("throttling_start", fmt.Sprintf("status=%s cooling=%s", thermalStatusName(status.Status), strings.Join(raisedCooling, " ")))
+	} else if !isThrottling && t.isThrottling {
+		t.RecordEvent("throttling_end", fmt.Sprintf("status=%s", thermalStatusName(status.Status)))
+	}
+	if t.status.Status >= 0 && status.Status >= 0 {
+		t.RecordChangeEvent("thermal_status", thermalStatusName(t.status.Status), thermalStatusName(status.Status))
+	}
+
+	t.temperatures = temperatures
+	t.activeCooling = activeCooling
+	t.status = status
+	t.isThrottling = isThrottling
+}
+
+func thermalStatusName(status int) string {
+	if status < 0 || status >= len(thermalStatusNames) {
+		return "UNKNOWN"
+	}
+	return thermalStatusNames[status]
+}
+
+func (t *ThermalStatPlugin) GetData() map[string]string {
+	ret := make(map[string]string)
+	temperatures := t.temperatures
+	for _, group := range thermalSensorGroups {
+		ret["temp_"+group.Name] = ""
+		if temp, ok := temperatures[group.Name]; ok {
+			ret["temp_"+group.Name] = fmt.Sprintf("%.1f", temp)
+		}
+	}
+	status := t.status
+	ret["thermal_status"] = ""
+	if status.Status >= 0 {
+		ret["thermal_status"] = strconv.Itoa(status.Status)
+	}
+	activeCooling := t.activeCooling
+	ret["cooling_active"] = strconv.Itoa(len(activeCooling))
+	ret["cooling_devices"] = strings.Join(activeCooling, " ")
+	ret["throttling"] = "0"
+	if t.isThrottling {
+		ret["throttling"] = "1"
+	}
+	return ret
+}
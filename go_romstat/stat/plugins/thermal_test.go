@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseThermalService(t *testing.T) {
+	output, err := os.ReadFile("testdata/thermalservice_android12.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := ParseThermalService(string(output)); status.Status != 2 {
+		t.Errorf("ERROR: status=%+v, expect status 2", *status)
+	}
+	if status := ParseThermalService("Can't find service: thermalservice\n"); status.Status != -1 {
+		t.Errorf("ERROR: status=%+v, expect no status", *status)
+	}
+}
+
+func TestThermalThrottlingEvents(t *testing.T) {
+	root := t.TempDir()
+	writeFakeFile(t, root, "sys/class/thermal/thermal_zone0/type", "cpu-1-0-usr\n")
+	writeFakeFile(t, root, "sys/class/thermal/thermal_zone0/temp", "48300\n")
+	writeFakeFile(t, root, "sys/class/thermal/thermal_zone1/type", "cpu-1-1-usr\n")
+	writeFakeFile(t, root, "sys/class/thermal/thermal_zone1/temp", "51200\n")
+	writeFakeFile(t, root, "sys/class/thermal/thermal_zone2/type", "battery\n")
+	writeFakeFile(t, root, "sys/class/thermal/thermal_zone2/temp", "33000\n")
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device0/type", "thermal-cpufreq-7\n")
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device0/max_state", "20\n")
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device0/cur_state", "0\n")
+	//the fan of the device is always on
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device1/type", "fan\n")
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device1/max_state", "3\n")
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device1/cur_state", "1\n")
+
+	plugin := &ThermalStatPlugin{sysRoot: root}
+	if !plugin.Open() {
+		t.Fatal("ERROR: no thermal zone found")
+	}
+	plugin.update(&ThermalServiceStatus{Status: 0})
+	if ret := plugin.GetData(); ret["throttling"] != "0" || ret["cooling_active"] != "1" || ret["cooling_devices"] != "fan:1/3" {
+		t.Errorf("ERROR: data=%v, expect the fan reported without throttling at its initial state", ret)
+	}
+	writeFakeFile(t, root, "sys/class/thermal/cooling_device0/cur_state", "3\n")
+	plugin.update(&ThermalServiceStatus{Status: 0})
+
+	ret := plugin.GetData()
+	expect := map[string]string{
+		"temp_cpu":        "51.2",
+		"temp_battery":    "33.0",
+		"temp_gpu":        "",
+		"cooling_active":  "2",
+		"cooling_devices": "fan:1/3 thermal-cpufreq-7:3/20",
+		"throttling":      "1",
+	}
+	for k, v := range expect {
+		if ret[k] != v {
+			t.Errorf("ERROR: %s=%s, expect %s", k, ret[k], v)
+		}
+	}
+	events := plugin.GetEvents()
+	if len(events) != 1 || events[0].Name != "throttling_start" || events[0].Detail != "status=NONE cooling=thermal-cpufreq-7:3/20" {
+		t.Errorf("ERROR: events=%v, expect one throttling_start event by the raised cooling device", events)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+type ThreadStatData struct {
+	Tid   int
+	Name  string
+	Ticks uint64  //utime + stime in clock ticks
+	Usage float64 //usage percent of one core
+	Core  int     //the cpu core last executed on
+}
+
+type ThreadStatPlugin struct {
+	procPath string //root of the procfs, /proc
+	debugLog utils.Logger
+	patterns []string          //the thread globs, a glob given twice is counted once
+	columns  map[string]string //the column name of every glob
+
+	lastPid       int32
+	lastTimestamp time.Time
+	lastTicks     map[int]uint64
+
+	topThreads     []*ThreadStatData
+	patternThreads map[string]*ThreadStatData //the sum of the threads matched each pattern
+}
+
+var rThreadColumnName = regexp.MustCompile(`[^0-9A-Za-z_]`)
+
+func threadColumnName(pattern string) string {
+	return "th_" + rThreadColumnName.ReplaceAllString(pattern, "_")
+}
+
+func (t *ThreadStatPlugin) Open() bool {
+	if t.procPath == "" {
+		t.procPath = "/proc"
+	}
+	if t.debugLog == nil {
+		t.debugLog = utils.DebugLogger
+	}
+	t.lastTicks = make(map[int]uint64)
+	t.patternThreads = make(map[string]*ThreadStatData)
+	//the globs differ only in the special characters share the column name, e.g. RenderThread* and RenderThread?,
+	//the later ones are suffixed by _2, _3...
+	t.patterns, t.columns = make([]string, 0), make(map[string]string)
+	usedColumns := make(map[string]bool)
+	for _, pattern := range data.GetCmdParameters().GetThreadPatterns() {
+		if _, ok := t.columns[pattern]; ok {
+			continue
+		}
+		column := threadColumnName(pattern)
+		for idx := 2; usedColumns[column]; idx++ {
+			column = fmt.Sprintf("%s_%d", threadColumnName(pattern), idx)
+		}
+		if column != threadColumnName(pattern) {
+			t.debugLog.Println("thread pattern", pattern, "is reported as", column, "since its column name is taken")
+		}
+		usedColumns[column] = true
+		t.patterns = append(t.patterns, pattern)
+		t.columns[pattern] = column
+	}
+	return true
+}
+
+func (t *ThreadStatPlugin) Close() {
+}
+
+func (t *ThreadStatPlugin) Run() {
+	go utils.SetTimer(1, t.collectThreadStat)
+}
+
+func (t *ThreadStatPlugin) GetTypes() []*data.PluginType {
+	types := make([]*data.PluginType, 0)
+	for i := 1; i <= data.GetCmdParameters().ThreadTopN; i++ {
+		types = append(types,
+			&data.PluginType{Name: fmt.Sprintf("top%d_name", i), DisplayName: fmt.Sprintf("top%d", i), IsCmdShow: false},
+			&data.PluginType{Name: fmt.Sprintf("top%d_cpu", i), DisplayName: fmt.Sprintf("top%d%%", i), IsCmdShow: true},
+			&data.PluginType{Name: fmt.Sprintf("top%d_core", i), DisplayName: fmt.Sprintf("top%dcore", i), IsCmdShow: false})
+	}
+	for _, pattern := range t.patterns {
+		name := t.columns[pattern]
+		types = append(types,
+			&data.PluginType{Name: name + "_cpu", DisplayName: pattern + "%", IsCmdShow: true},
+			&data.PluginType{Name: name + "_core", DisplayName: pattern + "core", IsCmdShow: false})
+	}
+	return types
+}
+
+// userHz is the clock ticks per second of procfs, USER_HZ is 100 on all android kernels
+const userHz = 100
+
+func (t *ThreadStatPlugin) readThreads(pid int32) []*ThreadStatData {
+	threads := make([]*ThreadStatData, 0)
+	taskPaths, _ := filepath.Glob(filepath.Join(t.procPath, strconv.Itoa(int(pid)), "task", "*"))
+	for _, taskPath := range taskPaths {
+		tid, err := strconv.Atoi(filepath.Base(taskPath))
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(taskPath, "stat"))
+		if err != nil {
+			continue
+		}
+		comm, fields := utils.SplitProcStat(string(content))
+		if len(fields) < 37 {
+			continue
+		}
+		utime, _ := strconv.ParseUint(fields[11], 10, 64)
+		stime, _ := strconv.ParseUint(fields[12], 10, 64)
+		core, _ := strconv.Atoi(fields[36])
+		threads = append(threads, &ThreadStatData{Tid: tid, Name: comm, Ticks: utime + stime, Core: core})
+	}
+	return threads
+}
+
+func (t *ThreadStatPlugin) collectThreadStat() {
+	pid := data.GetCmdParameters().GetPid()
+	threads := make([]*ThreadStatData, 0)
+	if pid != 0 {
+		threads = t.readThreads(pid)
+	}
+	t.update(pid, threads, time.Now())
+}
+
+// update computes the usage of the threads in the interval and selects the busiest ones. The usage is
+// based on the elapsed time, the ticks of /proc/stat are not used since the offline cores are not listed
+func (t *ThreadStatPlugin) update(pid int32, threads []*ThreadStatData, now time.Time) {
+	if pid != t.lastPid {
+		t.lastTicks = make(map[int]uint64)
+	}
+	var dertCoreTicks float64
+	if !t.lastTimestamp.IsZero() {
+		dertCoreTicks = now.Sub(t.lastTimestamp).Seconds() * userHz
+	}
+	lastTicks := t.lastTicks
+	t.lastPid, t.lastTimestamp, t.lastTicks = pid, now, make(map[int]uint64)
+	for _, thread := range threads {
+		t.lastTicks[thread.Tid] = thread.Ticks
+		//A new thread is counted from the next interval
+		if last, ok := lastTicks[thread.Tid]; ok && thread.Ticks >= last && dertCoreTicks > 0 {
+			thread.Usage = float64(thread.Ticks-last) * 100 / dertCoreTicks
+		}
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].Usage > threads[j].Usage
+	})
+
+	patternThreads := make(map[string]*ThreadStatData)
+	for _, pattern := range t.patterns {
+		patternThread := &ThreadStatData{Name: pattern, Core: -1}
+		for _, thread := range threads { //threads are sorted, the core is the busiest matched one
+			if matched, _ := path.Match(pattern, thread.Name); matched {
+				if patternThread.Core < 0 {
+					patternThread.Core = thread.Core
+				}
+				patternThread.Usage += thread.Usage
+			}
+		}
+		patternThreads[pattern] = patternThread
+	}
+	topN := data.GetCmdParameters().ThreadTopN
+	if topN < 0 {
+		topN = 0
+	}
+	if len(threads) > topN {
+		threads = threads[:topN]
+	}
+	t.topThreads = threads
+	t.patternThreads = patternThreads
+}
+
+func (t *ThreadStatPlugin) GetData() map[string]string {
+	ret := make(map[string]string)
+	topThreads := t.topThreads
+	for i := 1; i <= data.GetCmdParameters().ThreadTopN; i++ {
+		name, usage, core := "", "0.0", ""
+		if i <= len(topThreads) {
+			thread := topThreads[i-1]
+			name, usage, core = thread.Name, fmt.Sprintf("%.1f", thread.Usage), strconv.Itoa(thread.Core)
+		}
+		ret[fmt.Sprintf("top%d_name", i)] = name
+		ret[fmt.Sprintf("top%d_cpu", i)] = usage
+		ret[fmt.Sprintf("top%d_core", i)] = core
+	}
+	patternThreads := t.patternThreads
+	for _, pattern := range t.patterns {
+		name := t.columns[pattern]
+		usage, core := "0.0", ""
+		if thread, ok := patternThreads[pattern]; ok {
+			usage = fmt.Sprintf("%.1f", thread.Usage)
+			if thread.Core >= 0 {
+				core = strconv.Itoa(thread.Core)
+			}
+		}
+		ret[name+"_cpu"] = usage
+		ret[name+"_core"] = core
+	}
+	if !data.GetCmdParameters().IsPkgResolved() {
+		for name := range ret {
+			ret[name] = ""
+		}
+	}
+	return ret
+}
@@ -0,0 +1,101 @@
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+func writeFakeThread(t *testing.T, root string, tid int, name string, ticks int, core int) {
+	//utime and stime are the fields 14 and 15, processor is the field 39
+	content := fmt.Sprintf("%d (%s) S 1 1234 0 0 -1 4194368 100 0 0 0 %d %d 0 0 10 -10 30 0 12345 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 -1 %d 0 0 0 0 0\n",
+		tid, name, ticks-ticks/4, ticks/4, core)
+	writeFakeFile(t, root, fmt.Sprintf("1234/task/%d/stat", tid), content)
+}
+
+func TestThreadStatTopN(t *testing.T) {
+	params := data.GetCmdParameters()
+	defer func(topN int, threads string) { params.ThreadTopN, params.Threads = topN, threads }(params.ThreadTopN, params.Threads)
+	params.ThreadTopN, params.Threads = 2, "Worker*"
+
+	root := t.TempDir()
+	writeFakeThread(t, root, 1234, "com.haima.game", 1000, 0)
+	writeFakeThread(t, root, 1240, "UnityMain", 2000, 7)
+	writeFakeThread(t, root, 1241, "Worker 1", 400, 3)
+	writeFakeThread(t, root, 1242, "Worker 2", 400, 2)
+	plugin := &ThreadStatPlugin{procPath: root}
+	plugin.Open()
+	now := time.Now()
+	plugin.update(1234, plugin.readThreads(1234), now)
+
+	//1241 exits, 1250 is created and counted from the next interval
+	writeFakeThread(t, root, 1234, "com.haima.game", 1010, 0)
+	writeFakeThread(t, root, 1240, "UnityMain", 2160, 6)
+	writeFakeThread(t, root, 1242, "Worker 2", 440, 1)
+	writeFakeThread(t, root, 1250, "Worker 3", 500, 4)
+	if err := os.RemoveAll(filepath.Join(root, "1234/task/1241")); err != nil {
+		t.Fatal(err)
+	}
+	plugin.update(1234, plugin.readThreads(1234), now.Add(2*time.Second))
+	expect := map[string]string{
+		"top1_name": "UnityMain", "top1_cpu": "80.0", "top1_core": "6",
+		"top2_name": "Worker 2", "top2_cpu": "20.0", "top2_core": "1",
+		"th_Worker__cpu": "20.0", "th_Worker__core": "1",
+	}
+	ret := plugin.GetData()
+	if len(ret) != len(expect) {
+		t.Errorf("ERROR: data=%v, expect %v", ret, expect)
+	}
+	for name, value := range expect {
+		if ret[name] != value {
+			t.Errorf("ERROR: %s=%s, expect %s", name, ret[name], value)
+		}
+	}
+
+	setUnresolvedPackage(t)
+	if ret = plugin.GetData(); ret["top1_name"] != "" || ret["top1_cpu"] != "" || ret["th_Worker__cpu"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty columns before the package is resolved", ret)
+	}
+
+	params.ThreadTopN = -1
+	plugin.update(1234, plugin.readThreads(1234), now.Add(3*time.Second))
+	if len(plugin.topThreads) != 0 {
+		t.Errorf("ERROR: top threads=%d, expect 0 for the negative topn", len(plugin.topThreads))
+	}
+}
+
+func TestThreadColumnCollision(t *testing.T) {
+	params := data.GetCmdParameters()
+	defer func(topN int, threads string) { params.ThreadTopN, params.Threads = topN, threads }(params.ThreadTopN, params.Threads)
+	params.ThreadTopN, params.Threads = 0, "RenderThread*,RenderThread?,RenderThread*,hwuiTask*"
+
+	root := t.TempDir()
+	writeFakeThread(t, root, 1240, "RenderThread", 1000, 5)
+	writeFakeThread(t, root, 1241, "hwuiTask1", 400, 2)
+	plugin := &ThreadStatPlugin{procPath: root, debugLog: utils.NewDebugLogger()}
+	plugin.Open()
+	expect := []string{"th_RenderThread__cpu", "th_RenderThread__core", "th_RenderThread__2_cpu", "th_RenderThread__2_core", "th_hwuiTask__cpu", "th_hwuiTask__core"}
+	types := plugin.GetTypes()
+	if len(types) != len(expect) {
+		t.Fatalf("ERROR: types=%d, expect %v", len(types), expect)
+	}
+	for idx, pluginType := range types {
+		if pluginType.Name != expect[idx] {
+			t.Errorf("ERROR: type %d=%s, expect %s", idx, pluginType.Name, expect[idx])
+		}
+	}
+
+	now := time.Now()
+	plugin.update(1234, plugin.readThreads(1234), now)
+	writeFakeThread(t, root, 1240, "RenderThread", 1100, 5)
+	plugin.update(1234, plugin.readThreads(1234), now.Add(time.Second))
+	ret := plugin.GetData()
+	if len(ret) != len(expect) || ret["th_RenderThread__cpu"] != "100.0" || ret["th_RenderThread__2_cpu"] != "0.0" {
+		t.Errorf("ERROR: data=%v, expect a column of every distinct pattern", ret)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Keys of the per uid traffic counters, they are the prefixes of the network plugin columns
+const (
+	trafficTotal  = "app"
+	trafficWifi   = "app_wifi"
+	trafficMobile = "app_mobile"
+	trafficTcp    = "app_tcp"
+	trafficUdp    = "app_udp"
+)
+
+var trafficKeys = []string{trafficTotal, trafficWifi, trafficMobile, trafficTcp, trafficUdp}
+
+// classifyInterface returns the traffic key of the interface, empty for the other interfaces
+func classifyInterface(name string) string {
+	if strings.HasPrefix(name, "wlan") {
+		return trafficWifi
+	}
+	for _, prefix := range []string{"rmnet", "ccmni", "seth_lte", "pdp", "ppp"} {
+		if strings.HasPrefix(name, prefix) {
+			return trafficMobile
+		}
+	}
+	return ""
+}
+
+func addTraffic(counters map[string]*NetData, key string, recv uint64, send uint64) {
+	if key == "" {
+		return
+	}
+	if _, ok := counters[key]; !ok {
+		counters[key] = new(NetData)
+	}
+	counters[key].BytesRecv += recv
+	counters[key].BytesSend += send
+}
+
+// ParseQtaguidStats parses /proc/net/xt_qtaguid/stats of the kernels before 4.9, the counters are split
+// by interface and protocol, only the untagged rows are counted since the tagged ones are their subsets
+func ParseQtaguidStats(content string, uid int32) map[string]*NetData {
+	lines := strings.Split(content, "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	columns := make(map[string]int)
+	for idx, name := range strings.Fields(lines[0]) {
+		columns[name] = idx
+	}
+	for _, name := range []string{"iface", "acct_tag_hex", "uid_tag_int", "rx_bytes", "tx_bytes"} {
+		if _, ok := columns[name]; !ok {
+			return nil
+		}
+	}
+	_, hasProto := columns["rx_tcp_bytes"]
+	counters := make(map[string]*NetData)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(columns) || fields[columns["acct_tag_hex"]] != "0x0" || fields[columns["uid_tag_int"]] != strconv.Itoa(int(uid)) {
+			continue
+		}
+		value := func(name string) uint64 {
+			val, _ := strconv.ParseUint(fields[columns[name]], 10, 64)
+			return val
+		}
+		recv, send := value("rx_bytes"), value("tx_bytes")
+		addTraffic(counters, trafficTotal, recv, send)
+		addTraffic(counters, classifyInterface(fields[columns["iface"]]), recv, send)
+		if hasProto {
+			addTraffic(counters, trafficTcp, value("rx_tcp_bytes"), value("tx_tcp_bytes"))
+			addTraffic(counters, trafficUdp, value("rx_udp_bytes"), value("tx_udp_bytes"))
+		}
+	}
+	//the uid has no traffic yet if it has no rows
+	for _, key := range trafficKeys {
+		addTraffic(counters, key, 0, 0)
+	}
+	if !hasProto {
+		delete(counters, trafficTcp)
+		delete(counters, trafficUdp)
+	}
+	return counters
+}
+
+// ParseTrafficControllerUidStats parses mAppUidStatsMap of 'dumpsys connectivity trafficcontroller',
+// the BPF map keeps the total traffic of every uid since boot on android 9+, the rows are 'uid rxBytes rxPackets txBytes txPackets'
+func ParseTrafficControllerUidStats(output string, uid int32) (map[string]*NetData, bool) {
+	inMap := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, ":") {
+			inMap = strings.HasPrefix(line, "mAppUidStatsMap")
+			continue
+		}
+		fields := strings.Fields(line)
+		if !inMap || len(fields) != 5 || fields[0] != strconv.Itoa(int(uid)) {
+			continue
+		}
+		recv, err1 := strconv.ParseUint(fields[1], 10, 64)
+		send, err2 := strconv.ParseUint(fields[3], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+		return map[string]*NetData{trafficTotal: {BytesRecv: recv, BytesSend: send}}, true
+	}
+	//the map is available but the uid has no traffic yet
+	return map[string]*NetData{trafficTotal: new(NetData)}, strings.Contains(output, "mAppUidStatsMap")
+}
+
+var rNetstatsIdent = regexp.MustCompile(`^ident=\[\{type=(\w+).*\] uid=(-?\d+) set=\w+ tag=(0x[0-9a-f]+)`)
+var rNetstatsBucket = regexp.MustCompile(`rb=(\d+) rp=\d+ tb=(\d+)`)
+
+// netstatsTrafficKey returns the traffic key of a network type of NetworkIdentity,
+// it is the name before android 12 and the number after, TYPE_MOBILE=0 and TYPE_WIFI=1
+func netstatsTrafficKey(networkType string) string {
+	switch networkType {
+	case "MOBILE", "0":
+		return trafficMobile
+	case "WIFI", "1":
+		return trafficWifi
+	}
+	return ""
+}
+
+// ParseNetstatsDetail parses 'UID stats' of 'dumpsys netstats detail', the history since boot is preferred since
+// the complete history is pruned, the traffic is split into wifi and mobile
+func ParseNetstatsDetail(output string, uid int32) map[string]*NetData {
+	histories := make(map[string]map[string]*NetData)
+	inUidStats, hasUidStats, history, key, matched := false, false, "", "", false
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inUidStats = trimmed == "UID stats:"
+			hasUidStats = hasUidStats || inUidStats
+			continue
+		}
+		if !inUidStats {
+			continue
+		}
+		if strings.HasSuffix(trimmed, ":") {
+			history, matched = trimmed, false
+			continue
+		}
+		if sz := rNetstatsIdent.FindStringSubmatch(trimmed); len(sz) > 3 {
+			matched = sz[2] == strconv.Itoa(int(uid)) && sz[3] == "0x0"
+			key = netstatsTrafficKey(sz[1])
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if sz := rNetstatsBucket.FindStringSubmatch(trimmed); len(sz) > 2 {
+			recv, _ := strconv.ParseUint(sz[1], 10, 64)
+			send, _ := strconv.ParseUint(sz[2], 10, 64)
+			if _, ok := histories[history]; !ok {
+				histories[history] = make(map[string]*NetData)
+			}
+			addTraffic(histories[history], trafficTotal, recv, send)
+			addTraffic(histories[history], key, recv, send)
+		}
+	}
+	if !hasUidStats {
+		return nil
+	}
+	//the uid has no traffic yet if it is not in any history
+	counters := make(map[string]*NetData)
+	for _, history := range []string{"History since boot:", "Complete history:"} {
+		if historyCounters, ok := histories[history]; ok {
+			counters = historyCounters
+			break
+		}
+	}
+	for _, key := range []string{trafficTotal, trafficWifi, trafficMobile} {
+		addTraffic(counters, key, 0, 0)
+	}
+	return counters
+}
@@ -0,0 +1,126 @@
+package plugins
+
+import (
+	"os"
+	"testing"
+)
+
+func checkTraffic(t *testing.T, counters map[string]*NetData, expect map[string]NetData) {
+	t.Helper()
+	if len(counters) != len(expect) {
+		t.Errorf("ERROR: counters=%d, expect %d", len(counters), len(expect))
+	}
+	for key, v := range expect {
+		if current, ok := counters[key]; !ok || *current != v {
+			t.Errorf("ERROR: %s=%+v, expect %+v", key, current, v)
+		}
+	}
+}
+
+func TestParseQtaguidStats(t *testing.T) {
+	content := "idx iface acct_tag_hex uid_tag_int cnt_set rx_bytes rx_packets tx_bytes tx_packets rx_tcp_bytes rx_tcp_packets rx_udp_bytes rx_udp_packets rx_other_bytes rx_other_packets tx_tcp_bytes tx_tcp_packets tx_udp_bytes tx_udp_packets tx_other_bytes tx_other_packets\n" +
+		"2 wlan0 0x0 10123 0 1000 10 500 5 800 8 200 2 0 0 400 4 100 1 0 0\n" +
+		"3 wlan0 0x0 10123 1 3000 30 1500 15 3000 30 0 0 0 0 1500 15 0 0 0 0\n" +
+		"4 wlan0 0x3e8 10123 0 900 9 400 4 900 9 0 0 0 0 400 4 0 0 0 0\n" +
+		"5 rmnet_data0 0x0 10123 0 100 1 50 1 0 0 100 1 0 0 0 0 50 1 0 0\n" +
+		"6 wlan0 0x0 10124 0 7777 7 7777 7 7777 7 0 0 0 0 7777 7 0 0 0 0\n"
+	checkTraffic(t, ParseQtaguidStats(content, 10123), map[string]NetData{
+		trafficTotal:  {BytesRecv: 4100, BytesSend: 2050},
+		trafficWifi:   {BytesRecv: 4000, BytesSend: 2000},
+		trafficMobile: {BytesRecv: 100, BytesSend: 50},
+		trafficTcp:    {BytesRecv: 3800, BytesSend: 1900},
+		trafficUdp:    {BytesRecv: 300, BytesSend: 150},
+	})
+	if counters := ParseQtaguidStats("", 10123); counters != nil {
+		t.Errorf("ERROR: counters=%v, expect nil", counters)
+	}
+}
+
+func TestParseTrafficControllerUidStats(t *testing.T) {
+	output := "TrafficController\n" +
+		"  mAppUidStatsMap:\n" +
+		"    uid rxBytes rxPackets txBytes txPackets\n" +
+		"    1000 52311 211 43122 200\n" +
+		"    10123 9123456 7011 812345 5021\n" +
+		"  mStatsMapA:\n" +
+		"    ifaceIndex ifaceName tag_hex uid_int cnt_set rxBytes rxPackets txBytes txPackets\n" +
+		"    30 wlan0 0x0 10123 0 12345 10 1234 5\n"
+	counters, ok := ParseTrafficControllerUidStats(output, 10123)
+	if !ok {
+		t.Fatal("ERROR: mAppUidStatsMap should be available")
+	}
+	checkTraffic(t, counters, map[string]NetData{trafficTotal: {BytesRecv: 9123456, BytesSend: 812345}})
+	if counters, ok = ParseTrafficControllerUidStats(output, 10999); !ok || *counters[trafficTotal] != (NetData{}) {
+		t.Errorf("ERROR: counters=%v %v, expect zero traffic", counters, ok)
+	}
+	if _, ok = ParseTrafficControllerUidStats("Can't find service: connectivity", 10123); ok {
+		t.Error("ERROR: mAppUidStatsMap should not be available")
+	}
+}
+
+func TestParseNetstatsDetail(t *testing.T) {
+	cases := []struct {
+		file   string
+		uid    int32
+		expect map[string]NetData
+	}{
+		{"testdata/netstats_detail_android11.txt", 10123, map[string]NetData{
+			trafficTotal:  {BytesRecv: 8030000, BytesSend: 902000},
+			trafficWifi:   {BytesRecv: 8000000, BytesSend: 900000},
+			trafficMobile: {BytesRecv: 30000, BytesSend: 2000},
+		}},
+		{"testdata/netstats_detail_android13.txt", 10211, map[string]NetData{
+			trafficTotal:  {BytesRecv: 4108288, BytesSend: 205824},
+			trafficWifi:   {BytesRecv: 4096000, BytesSend: 204800},
+			trafficMobile: {BytesRecv: 10240, BytesSend: 1024},
+		}},
+		{"testdata/netstats_detail_android13.txt", 10999, map[string]NetData{
+			trafficTotal: {}, trafficWifi: {}, trafficMobile: {},
+		}},
+	}
+	for _, v := range cases {
+		output, err := os.ReadFile(v.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTraffic(t, ParseNetstatsDetail(string(output), v.uid), v.expect)
+	}
+}
+
+func TestUidTrafficSourceFallback(t *testing.T) {
+	var bpfReads, netstatsReads int
+	plugin := &NetworkStatPlugin{appSources: []*uidTrafficSource{
+		{read: func(uid int32) map[string]*NetData { bpfReads += 1; return nil }},
+		{read: func(uid int32) map[string]*NetData {
+			netstatsReads += 1
+			return map[string]*NetData{trafficTotal: {BytesRecv: uint64(netstatsReads) * 1024}}
+		}},
+	}}
+	for i := 0; i < 3; i++ {
+		plugin.updateAppSources(10123)
+	}
+	if bpfReads != 1 || netstatsReads != 3 {
+		t.Errorf("ERROR: bpf reads=%d netstats reads=%d, expect 1 and 3", bpfReads, netstatsReads)
+	}
+	if plugin.appSources[0].rates != nil || plugin.appSources[1].rates[trafficTotal] == nil {
+		t.Errorf("ERROR: rates are not from the fallback source")
+	}
+	plugin.totalRate = new(InterfaceRate)
+	if ret := plugin.GetData(); ret[trafficTotal+"_in"] == "" {
+		t.Errorf("ERROR: data=%v, expect the app traffic", ret)
+	}
+	setUnresolvedPackage(t)
+	if ret := plugin.GetData(); ret[trafficTotal+"_in"] != "" || ret["net_in"] == "" {
+		t.Errorf("ERROR: data=%v, expect empty app columns before the package is resolved", ret)
+	}
+
+	var fallbackReads int
+	plugin = &NetworkStatPlugin{appSources: []*uidTrafficSource{
+		{read: func(uid int32) map[string]*NetData { return map[string]*NetData{trafficTotal: new(NetData)} }},
+		{read: func(uid int32) map[string]*NetData { fallbackReads += 1; return nil }},
+	}}
+	plugin.updateAppSources(10123)
+	if fallbackReads != 0 {
+		t.Errorf("ERROR: fallback reads=%d while the first source is available", fallbackReads)
+	}
+}
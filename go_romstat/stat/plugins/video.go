@@ -0,0 +1,355 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"romstat/stat/data"
+	"romstat/stat/utils"
+)
+
+var (
+	//{codec, (09:40:12.004), (com.example.game, 12345, 10211), (android.media.mediacodec.codec=..., ...)} of android 11+
+	rMetricsCodecItem = regexp.MustCompile(`\{codec, \([^)]*\), \(([^,]*), (-?\d+), (-?\d+)\)`)
+	//[1:codec:10211:com.example.game:3210:0:1697702401512000000:12345:1:18:android.media.mediacodec.codec=...:] of android 10
+	rMetricsCodecItemV1 = regexp.MustCompile(`\[\d+:codec:(-?\d+):([^:]*):-?\d+:-?\d+:-?\d+:(-?\d+):`)
+	rMetricsCodecProp   = regexp.MustCompile(`android\.media\.mediacodec\.([\w.\-]+)=([^,:\]\)\}]*)`)
+
+	rResourcePid        = regexp.MustCompile(`^\s*Pid: (\d+)`)
+	rResourceClientName = regexp.MustCompile(`^\s*Name: (\S+)`)
+)
+
+// VideoDecoderInfo is a video decoder session of MediaCodec recorded by media.metrics
+type VideoDecoderInfo struct {
+	Package   string
+	Pid       int32
+	Uid       int32
+	Codec     string
+	Mime      string
+	Width     int
+	Height    int
+	FrameRate float64 //the actual frame rate of android 14+, or the configured one, -1 if not reported
+	Decoded   int64   //-1 if not reported
+	Dropped   int64   //-1 if not reported
+	Hardware  bool
+}
+
+// isHardwareCodec checks the component name, the software codecs of aosp are OMX.google.* and c2.android.*
+func isHardwareCodec(codec string) bool {
+	codec = strings.ToLower(codec)
+	for _, prefix := range []string{"omx.google.", "c2.android.", "c2.google."} {
+		if strings.HasPrefix(codec, prefix) {
+			return false
+		}
+	}
+	return !strings.Contains(codec, ".sw.") && !strings.Contains(codec, "ffmpeg")
+}
+
+func parseMetricsInt(props map[string]string, name string) int64 {
+	value, err := strconv.ParseInt(props[name], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+func parseMetricsFloat(props map[string]string, name string) float64 {
+	value, err := strconv.ParseFloat(props[name], 64)
+	if err != nil || value <= 0 {
+		return -1
+	}
+	return value
+}
+
+// parseMediaMetricsCodec parses a video decoder record of 'dumpsys media.metrics', nil for the other lines
+func parseMediaMetricsCodec(line string) *VideoDecoderInfo {
+	decoder := &VideoDecoderInfo{}
+	if sz := rMetricsCodecItem.FindStringSubmatch(line); len(sz) > 3 {
+		pid, _ := strconv.Atoi(sz[2])
+		uid, _ := strconv.Atoi(sz[3])
+		decoder.Package, decoder.Pid, decoder.Uid = sz[1], int32(pid), int32(uid)
+	} else if sz := rMetricsCodecItemV1.FindStringSubmatch(line); len(sz) > 3 {
+		uid, _ := strconv.Atoi(sz[1])
+		pid, _ := strconv.Atoi(sz[3])
+		decoder.Package, decoder.Pid, decoder.Uid = sz[2], int32(pid), int32(uid)
+	} else {
+		return nil
+	}
+	props := make(map[string]string)
+	for _, sz := range rMetricsCodecProp.FindAllStringSubmatch(line, -1) {
+		props[sz[1]] = strings.TrimSpace(sz[2])
+	}
+	if props["mode"] != "video" || props["encoder"] == "1" {
+		return nil
+	}
+	decoder.Codec, decoder.Mime = props["codec"], props["mime"]
+	decoder.Width, decoder.Height = int(parseMetricsInt(props, "width")), int(parseMetricsInt(props, "height"))
+	decoder.FrameRate = parseMetricsFloat(props, "framerate-actual")
+	if decoder.FrameRate < 0 {
+		decoder.FrameRate = parseMetricsFloat(props, "frame-rate")
+	}
+	//the frame counters are added in android 14, the latency samples are counted per decoded frame before
+	decoder.Decoded = parseMetricsInt(props, "frames-released")
+	if decoder.Decoded < 0 {
+		decoder.Decoded = parseMetricsInt(props, "latency.n")
+	}
+	decoder.Dropped = parseMetricsInt(props, "frames-dropped")
+	decoder.Hardware = isHardwareCodec(decoder.Codec)
+	return decoder
+}
+
+// ParseMediaMetricsCodecs parses the video decoder records of 'dumpsys media.metrics' in the dumped order,
+// MediaCodec submits the record when the codec is reconfigured or released
+func ParseMediaMetricsCodecs(output string) []*VideoDecoderInfo {
+	ret := make([]*VideoDecoderInfo, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if decoder := parseMediaMetricsCodec(line); decoder != nil {
+			ret = append(ret, decoder)
+		}
+	}
+	return ret
+}
+
+// LiveVideoDecoder is a video decoder instance which is not released yet
+type LiveVideoDecoder struct {
+	Pid      int32
+	Codec    string
+	Hardware bool
+}
+
+// ParseResourceManagerDecoders parses the video decoders held by the processes in 'dumpsys media.resource_manager',
+// MediaCodec adds the codec resource when the component is allocated and removes it when the codec is released
+func ParseResourceManagerDecoders(output string) []*LiveVideoDecoder {
+	ret := make([]*LiveVideoDecoder, 0)
+	var pid int32
+	var codec string
+	for _, line := range strings.Split(output, "\n") {
+		//the event logs repeat the resources of the added and removed clients
+		if strings.Contains(line, "Events logs") {
+			break
+		}
+		if sz := rResourcePid.FindStringSubmatch(line); len(sz) > 1 {
+			value, _ := strconv.Atoi(sz[1])
+			pid, codec = int32(value), ""
+		} else if strings.TrimSpace(line) == "Client:" {
+			codec = ""
+		} else if sz := rResourceClientName.FindStringSubmatch(line); len(sz) > 1 {
+			codec = sz[1]
+		} else if strings.Contains(line, "/video-codec:") && isVideoDecoderName(codec) {
+			ret = append(ret, &LiveVideoDecoder{Pid: pid, Codec: codec, Hardware: isHardwareCodec(codec)})
+			codec = ""
+		}
+	}
+	return ret
+}
+
+// isVideoDecoderName checks the component name, the resource of a codec does not tell a decoder from an encoder
+func isVideoDecoderName(codec string) bool {
+	codec = strings.ToLower(codec)
+	return strings.Contains(codec, "decoder") && !strings.Contains(codec, "encoder")
+}
+
+// matchVideoDecoder checks whether the decoder belongs to the target app, any decoder matches if no app is monitored
+func matchVideoDecoder(decoder *VideoDecoderInfo, isMonitorPkg bool, pkgName string, uid int32, hasUid bool) bool {
+	if !isMonitorPkg {
+		return true
+	}
+	return decoder.Package == pkgName || (hasUid && decoder.Uid == uid)
+}
+
+// selectVideoDecoder returns the latest decoder of the target app, the latest of all apps if no app is monitored
+func selectVideoDecoder(decoders []*VideoDecoderInfo, isMonitorPkg bool, pkgName string, uid int32, hasUid bool) *VideoDecoderInfo {
+	for idx := len(decoders) - 1; idx >= 0; idx-- {
+		if matchVideoDecoder(decoders[idx], isMonitorPkg, pkgName, uid, hasUid) {
+			return decoders[idx]
+		}
+	}
+	return nil
+}
+
+// VideoStatPlugin reports the video decoders of the target app. The live decoders are read from media.resource_manager.
+// The records of media.metrics are only submitted when a codec is released or reconfigured, so the codec, resolution
+// and frame rate are of the last released session, the decoded and dropped frames are the sums of the sessions
+// released in the sample interval
+type VideoStatPlugin struct {
+	shell *utils.AndroidShell
+
+	lock      sync.Mutex
+	live      []*LiveVideoDecoder //nil before the first collection
+	records   map[string]bool     //records of the last dump, nil before the first collection
+	decoder   *VideoDecoderInfo   //the last released session of the app, nil if the app has not decoded any video
+	decoded   int64               //frames of the sessions released since the last sample, -1 if not reported
+	dropped   int64
+	hasFrames bool //a session of the app is released since the last sample
+}
+
+func (t *VideoStatPlugin) Open() bool {
+	if t.shell == nil {
+		t.shell = utils.NewAndroidShell()
+	}
+	return true
+}
+
+func (t *VideoStatPlugin) Close() {
+}
+
+func (t *VideoStatPlugin) Run() {
+	//dumpsys media.codec does not dump the codec instances, the live decoders are read from media.resource_manager
+	go utils.SetTimer(5, t.collectVideoStat)
+}
+
+func (t *VideoStatPlugin) GetTypes() []*data.PluginType {
+	return []*data.PluginType{
+		{Name: "video_decoders", DisplayName: "decoders", IsCmdShow: true},
+		{Name: "video_live_codec", DisplayName: "liveCodec", IsCmdShow: false},
+		{Name: "video_live_hw", DisplayName: "liveHwDec", IsCmdShow: false},
+		{Name: "video_codec", DisplayName: "lastCodec", IsCmdShow: false},
+		{Name: "video_res", DisplayName: "lastRes", IsCmdShow: true},
+		{Name: "video_fps", DisplayName: "lastFps", IsCmdShow: true},
+		{Name: "video_decoded", DisplayName: "decoded", IsCmdShow: false},
+		{Name: "video_dropped", DisplayName: "dropped", IsCmdShow: true},
+		{Name: "video_hw", DisplayName: "lastHwDec", IsCmdShow: false},
+	}
+}
+
+// collectVideoStat collects the decoders of the monitored app, all decoders if no app is monitored
+func (t *VideoStatPlugin) collectVideoStat() {
+	if !data.GetCmdParameters().IsPkgResolved() {
+		t.reset()
+		return
+	}
+	isMonitorPkg := len(data.GetCmdParameters().GetPkgPatterns()) > 0
+	live := ParseResourceManagerDecoders(t.shell.RunShell("dumpsys media.resource_manager"))
+	if isMonitorPkg {
+		pids := make(map[int32]bool)
+		for _, pid := range data.GetCmdParameters().GetPids() {
+			pids[pid] = true
+		}
+		appLive := make([]*LiveVideoDecoder, 0)
+		for _, decoder := range live {
+			if pids[decoder.Pid] {
+				appLive = append(appLive, decoder)
+			}
+		}
+		live = appLive
+	}
+	t.updateLive(live)
+	uid, hasUid := data.GetCmdParameters().GetUid()
+	t.update(t.shell.RunShell("dumpsys media.metrics"), isMonitorPkg, data.GetCmdParameters().GetMonitorPkgName(), uid, hasUid)
+}
+
+// reset drops the decoders, the columns are empty until the next collection
+func (t *VideoStatPlugin) reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.live, t.records, t.decoder = nil, nil, nil
+	t.decoded, t.dropped, t.hasFrames = 0, 0, false
+}
+
+// updateLive saves the live decoders of the app
+func (t *VideoStatPlugin) updateLive(live []*LiveVideoDecoder) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.live = live
+}
+
+// update adds the frames of the sessions of the app which are not in the last dump, the sessions in the
+// first dump are released before the monitoring
+func (t *VideoStatPlugin) update(output string, isMonitorPkg bool, pkgName string, uid int32, hasUid bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	records := make(map[string]bool)
+	decoders := make([]*VideoDecoderInfo, 0)
+	for _, line := range strings.Split(output, "\n") {
+		decoder := parseMediaMetricsCodec(line)
+		if decoder == nil {
+			continue
+		}
+		records[line] = true
+		if !matchVideoDecoder(decoder, isMonitorPkg, pkgName, uid, hasUid) {
+			continue
+		}
+		decoders = append(decoders, decoder)
+		if t.records == nil || t.records[line] {
+			continue
+		}
+		if !t.hasFrames {
+			t.decoded, t.dropped, t.hasFrames = -1, -1, true
+		}
+		t.decoded = addFrames(t.decoded, decoder.Decoded)
+		t.dropped = addFrames(t.dropped, decoder.Dropped)
+	}
+	t.records = records
+	t.decoder = selectVideoDecoder(decoders, isMonitorPkg, pkgName, uid, hasUid)
+}
+
+// addFrames adds the frames of a session, -1 is kept if none of the sessions reports the frames
+func addFrames(total int64, frames int64) int64 {
+	if frames < 0 {
+		return total
+	}
+	if total < 0 {
+		return frames
+	}
+	return total + frames
+}
+
+func (t *VideoStatPlugin) GetData() map[string]string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := make(map[string]string)
+	for _, name := range []string{"video_decoders", "video_live_codec", "video_live_hw", "video_codec", "video_res", "video_fps", "video_decoded", "video_dropped", "video_hw"} {
+		ret[name] = ""
+	}
+	if t.live != nil {
+		ret["video_decoders"] = strconv.Itoa(len(t.live))
+		codecs := make([]string, 0)
+		for _, decoder := range t.live {
+			codecs = append(codecs, decoder.Codec)
+			if decoder.Hardware {
+				ret["video_live_hw"] = "1"
+			} else if ret["video_live_hw"] == "" {
+				ret["video_live_hw"] = "0"
+			}
+		}
+		sort.Strings(codecs)
+		ret["video_live_codec"] = strings.Join(codecs, " ")
+	}
+	//the frames are reported once in the sample the session is released
+	if t.records != nil {
+		ret["video_decoded"], ret["video_dropped"] = "0", "0"
+		if t.hasFrames {
+			ret["video_decoded"], ret["video_dropped"] = "", ""
+			if t.decoded >= 0 {
+				ret["video_decoded"] = strconv.FormatInt(t.decoded, 10)
+			}
+			if t.dropped >= 0 {
+				ret["video_dropped"] = strconv.FormatInt(t.dropped, 10)
+			}
+		}
+		t.decoded, t.dropped, t.hasFrames = 0, 0, false
+	}
+	decoder := t.decoder
+	if decoder == nil {
+		return ret
+	}
+	ret["video_codec"] = decoder.Codec
+	if decoder.Width > 0 && decoder.Height > 0 {
+		ret["video_res"] = fmt.Sprintf("%dx%d", decoder.Width, decoder.Height)
+	}
+	if decoder.FrameRate > 0 {
+		ret["video_fps"] = fmt.Sprintf("%.1f", decoder.FrameRate)
+	}
+	ret["video_hw"] = "0"
+	if decoder.Hardware {
+		ret["video_hw"] = "1"
+	}
+	return ret
+}
@@ -0,0 +1,120 @@
+package plugins
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseMediaMetricsCodecs(t *testing.T) {
+	cases := []struct {
+		filename string
+		decoders int
+		expect   VideoDecoderInfo
+	}{
+		{"testdata/media_metrics_android10.txt", 2, VideoDecoderInfo{Package: "com.haima.cloudgame", Pid: 12345, Uid: 10211, Codec: "OMX.qcom.video.decoder.avc", Mime: "video/avc",
+			Width: 1280, Height: 720, FrameRate: -1, Decoded: 5120, Dropped: -1, Hardware: true}},
+		{"testdata/media_metrics_android12.txt", 2, VideoDecoderInfo{Package: "com.haima.cloudgame", Pid: 12345, Uid: 10211, Codec: "c2.qti.hevc.decoder.low_latency", Mime: "video/hevc",
+			Width: 1920, Height: 1080, FrameRate: 60, Decoded: 21467, Dropped: -1, Hardware: true}},
+		{"testdata/media_metrics_android14.txt", 2, VideoDecoderInfo{Package: "com.haima.cloudgame", Pid: 23456, Uid: 10211, Codec: "c2.exynos.hevc.decoder", Mime: "video/hevc",
+			Width: 2400, Height: 1080, FrameRate: 59.400002, Decoded: 84930, Dropped: 418, Hardware: true}},
+	}
+	for _, v := range cases {
+		output, err := os.ReadFile(v.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoders := ParseMediaMetricsCodecs(string(output))
+		if len(decoders) != v.decoders {
+			t.Errorf("ERROR: %s decoders=%d, expect %d", v.filename, len(decoders), v.decoders)
+			continue
+		}
+		decoder := selectVideoDecoder(decoders, true, "com.haima.cloudgame", 0, false)
+		if decoder == nil || *decoder != v.expect {
+			t.Errorf("ERROR: %s decoder=%+v, expect %+v", v.filename, decoder, v.expect)
+		}
+	}
+
+	output, _ := os.ReadFile("testdata/media_metrics_android14.txt")
+	decoders := ParseMediaMetricsCodecs(string(output))
+	if decoders[0].Hardware || decoders[0].Dropped != 47 {
+		t.Errorf("ERROR: decoder=%+v, expect the software decoder dropped 47 frames", *decoders[0])
+	}
+	output, _ = os.ReadFile("testdata/media_metrics_android10.txt")
+	decoders = ParseMediaMetricsCodecs(string(output))
+	if decoder := selectVideoDecoder(decoders, false, "", 0, false); decoder == nil || decoder.Package != "com.android.camera" {
+		t.Errorf("ERROR: decoder=%+v, expect the latest of all apps", decoder)
+	}
+	if decoder := selectVideoDecoder(decoders, true, "com.other.app", 10211, true); decoder == nil || decoder.Codec != "OMX.qcom.video.decoder.avc" {
+		t.Errorf("ERROR: decoder=%+v, expect matched by uid", decoder)
+	}
+}
+
+func TestParseResourceManagerDecoders(t *testing.T) {
+	output, err := os.ReadFile("testdata/resource_manager_android12.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the audio decoder, the video encoder and the clients in the event logs are not counted
+	expect := []LiveVideoDecoder{
+		{Pid: 12345, Codec: "c2.qti.hevc.decoder.low_latency", Hardware: true},
+		{Pid: 23456, Codec: "c2.android.avc.decoder", Hardware: false},
+	}
+	decoders := ParseResourceManagerDecoders(string(output))
+	if len(decoders) != len(expect) {
+		t.Fatalf("ERROR: decoders=%d, expect %d", len(decoders), len(expect))
+	}
+	for idx, decoder := range decoders {
+		if *decoder != expect[idx] {
+			t.Errorf("ERROR: decoder %d=%+v, expect %+v", idx, *decoder, expect[idx])
+		}
+	}
+}
+
+func TestVideoLiveDecoders(t *testing.T) {
+	plugin := &VideoStatPlugin{}
+	if ret := plugin.GetData(); ret["video_decoders"] != "" || ret["video_live_hw"] != "" {
+		t.Errorf("ERROR: data=%v, expect empty columns before the first collection", ret)
+	}
+	plugin.updateLive([]*LiveVideoDecoder{})
+	if ret := plugin.GetData(); ret["video_decoders"] != "0" || ret["video_live_codec"] != "" || ret["video_live_hw"] != "" {
+		t.Errorf("ERROR: data=%v, expect no live decoder", ret)
+	}
+	plugin.updateLive([]*LiveVideoDecoder{{Pid: 12345, Codec: "c2.qti.hevc.decoder", Hardware: true}, {Pid: 12345, Codec: "c2.android.avc.decoder"}})
+	if ret := plugin.GetData(); ret["video_decoders"] != "2" || ret["video_live_codec"] != "c2.android.avc.decoder c2.qti.hevc.decoder" || ret["video_live_hw"] != "1" {
+		t.Errorf("ERROR: data=%v, expect the hardware and software decoders", ret)
+	}
+
+	//the columns are empty until one of the packages given by globs is in foreground
+	setUnresolvedPackage(t)
+	plugin.collectVideoStat()
+	for name, value := range plugin.GetData() {
+		if value != "" {
+			t.Errorf("ERROR: %s=%s, expect empty before the package is resolved", name, value)
+		}
+	}
+}
+
+func TestVideoStatInterval(t *testing.T) {
+	output, err := os.ReadFile("testdata/media_metrics_android14.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := &VideoStatPlugin{}
+	//the sessions released before the monitoring are not counted
+	plugin.update(string(output), true, "com.haima.cloudgame", 10211, true)
+	if ret := plugin.GetData(); ret["video_decoded"] != "0" || ret["video_dropped"] != "0" || ret["video_res"] != "2400x1080" {
+		t.Errorf("ERROR: data=%v, expect no frames of the last session 2400x1080", ret)
+	}
+	record := "5811: {codec, (10:06:40.002), (com.haima.cloudgame, 23456, 10211), (android.media.mediacodec.codec=c2.exynos.hevc.decoder, " +
+		"android.media.mediacodec.mime=video/hevc, android.media.mediacodec.mode=video, android.media.mediacodec.encoder=0, android.media.mediacodec.width=1920, " +
+		"android.media.mediacodec.height=1080, android.media.mediacodec.frames-released=3000, android.media.mediacodec.frames-dropped=12, " +
+		"android.media.mediacodec.framerate-actual=50.000000)}\n"
+	plugin.update(string(output)+record, true, "com.haima.cloudgame", 10211, true)
+	if ret := plugin.GetData(); ret["video_decoded"] != "3000" || ret["video_dropped"] != "12" || ret["video_res"] != "1920x1080" {
+		t.Errorf("ERROR: data=%v, expect the frames of the released session", ret)
+	}
+	//the frames are reported once
+	if ret := plugin.GetData(); ret["video_decoded"] != "0" || ret["video_fps"] != "50.0" {
+		t.Errorf("ERROR: data=%v, expect no frames in the next sample", ret)
+	}
+}
@@ -6,6 +6,7 @@ package stat
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -31,6 +32,7 @@ type PluginManager struct {
 	header          *Header
 	displayLogger   utils.Logger
 	debugLogger     utils.Logger
+	summary         *SessionSummary
 }
 
 var sep = "\t"
@@ -39,6 +41,11 @@ var lineNum = 30
 var headerWriteFlag = false
 
 var fpWriter *utils.RsaWriter
+var summaryWriter *utils.RsaWriter
+var eventWriter *utils.RsaWriter
+
+// outputDir is the directory of the output files on the device
+var outputDir = "/data/local/tmp"
 
 type Plugin interface {
 	Open() bool
@@ -48,6 +55,11 @@ type Plugin interface {
 	GetData() map[string]string
 }
 
+// EventPlugin is implemented by plugins which record timeline events besides the sample columns
+type EventPlugin interface {
+	GetEvents() []*data.PluginEvent
+}
+
 func (t *PluginManager) outputHeaderLines() {
 	lines := []string{"--------"}
 	for _, v := range t.header.TypeLst {
@@ -59,6 +71,8 @@ func (t *PluginManager) outputHeaderLines() {
 			lines = append(lines, "----network----")
 		} else if v == "ping" {
 			lines = append(lines, "----ping----")
+		} else {
+			lines = append(lines, "----"+v+"----")
 		}
 	}
 	t.displayLogger.Println(strings.Join(lines, "    "))
@@ -89,33 +103,53 @@ func initFpOutput() {
 		pemContent := string(fContent)
 		pubKey = &pemContent
 	}
+	dir := outputDir
 	if runtime.GOOS == "windows" {
-		fpWriter = utils.NewRsaWriter("./out.hmp", pubKey)
-	} else {
-		fpWriter = utils.NewRsaWriter("/data/local/tmp/out.hmp", pubKey)
+		dir = "."
 	}
+	fpWriter = utils.NewRsaWriter(filepath.Join(dir, "out.hmp"), pubKey)
+	summaryWriter = utils.NewRsaWriter(filepath.Join(dir, "out_summary.hmp"), pubKey)
+	eventWriter = utils.NewRsaWriter(filepath.Join(dir, "out_event.hmp"), pubKey)
+	eventWriter.WriteString("时间" + csvSep + "插件" + csvSep + "事件" + csvSep + "详情\n")
+	eventWriter.Flush()
 }
 
 func InitStatByType(typeLst []string) *PluginManager {
-	LoadAllPlugins()
+	if registerPlugins == nil {
+		LoadAllPlugins()
+	}
 
 	initFpOutput()
 
 	mgmt := new(PluginManager)
 	mgmt.displayLogger = utils.DisplayLogger
 	mgmt.debugLogger = utils.DebugLogger
-	mgmt.currentRunTypes = typeLst
+	mgmt.summary = NewSessionSummary()
 	mgmt.data = make(map[string]Plugin)
 	pluginTypes := make([]*data.PluginType, 0)
+	runTypes := make([]string, 0)
 	for _, pluginName := range typeLst {
-		plugin := registerPlugins[pluginName]
-		plugin.Open()
+		plugin, ok := registerPlugins[pluginName]
+		//the skipped plugins are printed before the header, so the plugins given by -plugins are not lost silently
+		if !ok {
+			mgmt.displayLogger.Println("WARNING: unknown plugin", pluginName)
+			mgmt.debugLogger.Println("WARNING: unknown plugin", pluginName)
+			continue
+		}
+		//the plugin is not available on the device, e.g. no gpu node or no battery
+		if !plugin.Open() {
+			mgmt.displayLogger.Println("WARNING: plugin is not available, skipped", pluginName)
+			mgmt.debugLogger.Println("WARNING: plugin is not available, skipped", pluginName)
+			continue
+		}
 		pluginTypes = append(pluginTypes, plugin.GetTypes()...)
 		mgmt.data[pluginName] = plugin
+		runTypes = append(runTypes, pluginName)
 	}
+	mgmt.currentRunTypes = runTypes
 	mgmt.itemDataChan = make(chan *ItemData)
 
-	mgmt.header = &Header{TypeLst: typeLst, PluginTypes: pluginTypes}
+	mgmt.header = &Header{TypeLst: runTypes, PluginTypes: pluginTypes}
 	mgmt.outputHeaderLines()
 	return mgmt
 }
@@ -154,9 +188,19 @@ func (t *PluginManager) Start(seconds int) {
 		mItem := new(MemDataItem)
 		mItem.TimeStamp = time.Now().Unix()
 		mItem.ItemData = make(map[string]string)
+		segment := ""
+		for _, pluginName := range t.currentRunTypes {
+			if segmentPlugin, ok := t.data[pluginName].(SegmentPlugin); ok && segment == "" {
+				segment = segmentPlugin.GetSegment(printData.Data[pluginName])
+			}
+		}
 		for _, pluginName := range t.currentRunTypes {
 			mapData := printData.Data[pluginName]
 			types := t.data[pluginName].GetTypes()
+			isSessionSample := true
+			if filter, ok := t.data[pluginName].(SessionFilter); ok {
+				isSessionSample = filter.IsSessionSample(mapData)
+			}
 			for _, k := range types {
 				val := mapData[k.Name]
 				fileOutputLine = append(fileOutputLine, val)
@@ -165,10 +209,36 @@ func (t *PluginManager) Start(seconds int) {
 				}
 				key := fmt.Sprintf("%s.%s", pluginName, k.Name)
 				mItem.ItemData[key] = mapData[k.Name]
+				if isSessionSample {
+					t.summary.Add(segment, key, val)
+				}
 			}
 		}
 		t.displayLogger.Println(strings.Join(cmdOutputLine, sep))
 		fpWriter.WriteString(strings.Join(fileOutputLine, csvSep) + "\n")
 		fpWriter.Flush()
+		t.outputEvents()
+	}
+}
+
+// outputEvents writes the timeline events recorded by plugins since the last sample
+func (t *PluginManager) outputEvents() {
+	for _, pluginName := range t.currentRunTypes {
+		eventPlugin, ok := t.data[pluginName].(EventPlugin)
+		if !ok {
+			continue
+		}
+		for _, event := range eventPlugin.GetEvents() {
+			timeSecFmt := time.UnixMilli(event.TimeStamp).In(time.FixedZone("CST", 8*3600)).Format("15:04:05")
+			detail := strings.ReplaceAll(event.Detail, csvSep, " ")
+			t.displayLogger.Println("[EVENT]", timeSecFmt, pluginName, event.Name, detail)
+			eventWriter.WriteString(strings.Join([]string{timeSecFmt, pluginName, event.Name, detail}, csvSep) + "\n")
+			eventWriter.Flush()
+		}
 	}
 }
+
+// OutputSummary prints the session aggregates and saves them into the summary file
+func (t *PluginManager) OutputSummary() {
+	t.summary.Output(t.displayLogger, summaryWriter)
+}
@@ -0,0 +1,39 @@
+package stat
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"romstat/stat/plugins"
+	"romstat/stat/utils"
+)
+
+func TestInitStatByTypeUnavailablePsi(t *testing.T) {
+	defer func(dir string, logger utils.Logger) {
+		outputDir, utils.DisplayLogger, registerPlugins = dir, logger, nil
+	}(outputDir, utils.DisplayLogger)
+	outputDir = t.TempDir()
+	var output bytes.Buffer
+	utils.DisplayLogger = log.New(&output, "", 0)
+	utils.DebugLogger = utils.NewDebugLogger()
+	registerPlugins = nil
+	RegPlugin("psi", plugins.NewPsiStatPlugin(t.TempDir()))
+
+	mgmt := InitStatByType([]string{"psi", "unknown"})
+	if _, ok := mgmt.data["psi"]; !ok || len(mgmt.currentRunTypes) != 1 {
+		t.Fatalf("ERROR: run types=%v, expect psi without PSI of the kernel", mgmt.currentRunTypes)
+	}
+	if !strings.Contains(output.String(), "WARNING: unknown plugin unknown") {
+		t.Errorf("ERROR: output=%s, expect the unknown plugin on the console", output.String())
+	}
+	mgmt.outputEvents()
+	if !strings.Contains(output.String(), "psi psi_unavailable") {
+		t.Errorf("ERROR: output=%s, expect the psi_unavailable event", output.String())
+	}
+	mgmt.outputEvents()
+	if strings.Count(output.String(), "psi_unavailable") != 1 {
+		t.Errorf("ERROR: output=%s, expect psi_unavailable once", output.String())
+	}
+}
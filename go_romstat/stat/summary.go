@@ -0,0 +1,129 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package stat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"romstat/stat/utils"
+)
+
+// SessionSegment is the segment of the aggregates of the whole session
+const SessionSegment = "session"
+
+// SessionFilter is implemented by plugins whose samples are not always
+// representative for the session, e.g. display samples taken while the
+// monitored application is not in foreground
+type SessionFilter interface {
+	IsSessionSample(itemData map[string]string) bool
+}
+
+// SegmentPlugin is implemented by plugins which split the session into segments,
+// e.g. the display plugin segments the samples by the resumed activity
+type SegmentPlugin interface {
+	GetSegment(itemData map[string]string) string
+}
+
+type SummaryItem struct {
+	Count int
+	Total float64
+	Min   float64
+	Max   float64
+}
+
+func (t *SummaryItem) Avg() float64 {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / float64(t.Count)
+}
+
+type segmentSummary struct {
+	keys  []string
+	items map[string]*SummaryItem
+}
+
+// SessionSummary aggregates the numeric columns of every sample row,
+// for the whole session and for every segment
+type SessionSummary struct {
+	segments []string
+	items    map[string]*segmentSummary
+	lock     sync.Mutex
+}
+
+func NewSessionSummary() *SessionSummary {
+	return &SessionSummary{
+		segments: make([]string, 0),
+		items:    make(map[string]*segmentSummary),
+	}
+}
+
+// Add aggregates the value into the session and into the segment if it is given
+func (t *SessionSummary) Add(segment string, key string, value string) {
+	val, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.add(SessionSegment, key, val)
+	if segment != "" && segment != SessionSegment {
+		t.add(segment, key, val)
+	}
+}
+
+func (t *SessionSummary) add(segment string, key string, val float64) {
+	segSummary, ok := t.items[segment]
+	if !ok {
+		segSummary = &segmentSummary{keys: make([]string, 0), items: make(map[string]*SummaryItem)}
+		t.items[segment] = segSummary
+		t.segments = append(t.segments, segment)
+	}
+	item, ok := segSummary.items[key]
+	if !ok {
+		item = &SummaryItem{Min: val, Max: val}
+		segSummary.items[key] = item
+		segSummary.keys = append(segSummary.keys, key)
+	}
+	item.Count += 1
+	item.Total += val
+	if val < item.Min {
+		item.Min = val
+	}
+	if val > item.Max {
+		item.Max = val
+	}
+}
+
+func (t *SessionSummary) Get(segment string, key string) *SummaryItem {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if segSummary, ok := t.items[segment]; ok {
+		return segSummary.items[key]
+	}
+	return nil
+}
+
+// Output writes one line per aggregated column, each line is flushed separately
+// to keep the rsa encrypted block size small
+func (t *SessionSummary) Output(logger utils.Logger, writer *utils.RsaWriter) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	writer.WriteString("分段" + csvSep + "指标" + csvSep + "平均值" + csvSep + "最小值" + csvSep + "最大值" + csvSep + "采样数\n")
+	writer.Flush()
+	for _, segment := range t.segments {
+		logger.Println("--------summary: " + segment + "--------")
+		segSummary := t.items[segment]
+		for _, key := range segSummary.keys {
+			item := segSummary.items[key]
+			line := fmt.Sprintf("%s%s%s%s%.2f%s%.2f%s%.2f%s%d", segment, csvSep, key, csvSep, item.Avg(), csvSep, item.Min, csvSep, item.Max, csvSep, item.Count)
+			logger.Println(fmt.Sprintf("%-24s avg=%.2f min=%.2f max=%.2f n=%d", key, item.Avg(), item.Min, item.Max, item.Count))
+			writer.WriteString(line + "\n")
+			writer.Flush()
+		}
+	}
+}
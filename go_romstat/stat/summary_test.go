@@ -0,0 +1,43 @@
+package stat
+
+import (
+	"testing"
+)
+
+func TestSessionSummary(t *testing.T) {
+	summary := NewSessionSummary()
+	for _, v := range []struct {
+		segment string
+		value   string
+	}{
+		{"com.haima.cloudgame/.GameActivity", "60"},
+		{"com.haima.cloudgame/.GameActivity", "50"},
+		{"background", "0"},
+		{"", "40"},
+		{"com.haima.cloudgame/.MenuActivity", ""},
+		{"com.haima.cloudgame/.MenuActivity", "NaN"},
+	} {
+		summary.Add(v.segment, "display.fps", v.value)
+	}
+	cases := []struct {
+		segment string
+		expect  *SummaryItem
+	}{
+		{SessionSegment, &SummaryItem{Count: 4, Total: 150, Min: 0, Max: 60}},
+		{"com.haima.cloudgame/.GameActivity", &SummaryItem{Count: 2, Total: 110, Min: 50, Max: 60}},
+		{"background", &SummaryItem{Count: 1, Total: 0, Min: 0, Max: 0}},
+		{"com.haima.cloudgame/.MenuActivity", nil},
+	}
+	for _, v := range cases {
+		item := summary.Get(v.segment, "display.fps")
+		if (item == nil) != (v.expect == nil) || (item != nil && *item != *v.expect) {
+			t.Errorf("ERROR: %s item=%+v, expect %+v", v.segment, item, v.expect)
+		}
+	}
+	if avg := summary.Get(SessionSegment, "display.fps").Avg(); avg != 37.5 {
+		t.Errorf("ERROR: avg=%f, expect 37.5", avg)
+	}
+	if len(summary.segments) != 3 || summary.segments[0] != SessionSegment {
+		t.Errorf("ERROR: segments=%v, expect the session first and no empty segment", summary.segments)
+	}
+}
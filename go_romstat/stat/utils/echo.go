@@ -0,0 +1,31 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package utils
+
+import (
+	"net"
+)
+
+// ServeUdpEcho sends every datagram back to its sender, it is the responder of the udp probe
+func ServeUdpEcho(conn net.PacketConn) error {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		//the lost echo is counted as the loss by the prober
+		conn.WriteTo(buf[:n], addr)
+	}
+}
+
+// RunUdpEchoServer listens on the address and serves the udp echo, e.g. ':7777'
+func RunUdpEchoServer(address string) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return ServeUdpEcho(conn)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadFileString reads a proc or sysfs file, returns an empty string if it cannot be read
+func ReadFileString(filename string) string {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// ReadFileInt reads a proc or sysfs file which contains a single integer
+func ReadFileInt(filename string) (int64, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// ParseCpuList parses a cpu list of sysfs, e.g. "0-3,6" to [0 1 2 3 6]
+func ParseCpuList(cpuList string) []int {
+	cpus := make([]int, 0)
+	for _, part := range strings.Split(strings.TrimSpace(cpuList), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+// SplitProcStat splits the content of /proc/<pid>/stat or /proc/<pid>/task/<tid>/stat,
+// returns the comm and the fields after it, fields[0] is the state (the 3rd field of proc(5))
+func SplitProcStat(content string) (string, []string) {
+	start := strings.Index(content, "(")
+	end := strings.LastIndex(content, ")")
+	if start < 0 || end < start {
+		return "", nil
+	}
+	return content[start+1 : end], strings.Fields(content[end+1:])
+}
+
+// ParseProcKeyValue parses the 'Key: value' files like /proc/meminfo, /proc/<pid>/status and
+// /proc/<pid>/smaps_rollup, the value is the first integer after the colon, the unit is dropped
+func ParseProcKeyValue(content string) map[string]int64 {
+	ret := make(map[string]int64)
+	for _, line := range strings.Split(content, "\n") {
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
+		}
+		fields := strings.Fields(line[idx+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		val, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		ret[strings.TrimSpace(line[:idx])] = val
+	}
+	return ret
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2021-2023 https://www.haimacloud.com/
+// SPDX-License-Identifier: MIT
+
+package utils
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rDnsAddresses = regexp.MustCompile(`DnsAddresses: \[([^\]]*)\]`)
+
+// ParseDnsAddresses parses the dns servers of the first network in 'dumpsys connectivity',
+// e.g. 'DnsAddresses: [ /192.168.1.1,/fe80::1%wlan0 ]'
+func ParseDnsAddresses(output string) []string {
+	servers := make([]string, 0)
+	sz := rDnsAddresses.FindStringSubmatch(output)
+	if len(sz) < 2 {
+		return servers
+	}
+	for _, addr := range strings.Split(sz[1], ",") {
+		addr = strings.TrimPrefix(strings.TrimSpace(addr), "/")
+		if net.ParseIP(strings.SplitN(addr, "%", 2)[0]) != nil {
+			servers = append(servers, addr)
+		}
+	}
+	return servers
+}
+
+type deviceResolver struct {
+	mutex       sync.Mutex
+	servers     []string
+	lastUpdated time.Time
+}
+
+var resolver deviceResolver
+
+// getServers returns the dns servers of the active network, refreshed every 30 seconds
+func (t *deviceResolver) getServers() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if time.Since(t.lastUpdated) >= 30*time.Second {
+		t.lastUpdated = time.Now()
+		t.servers = ParseDnsAddresses(NewAndroidShell().RunShell("dumpsys connectivity"))
+		if len(t.servers) == 0 {
+			//net.dns1 is only set before android 8
+			if dns1 := strings.TrimSpace(NewAndroidShell().RunShell("getprop net.dns1")); net.ParseIP(dns1) != nil {
+				t.servers = []string{dns1}
+			}
+		}
+	}
+	return t.servers
+}
+
+// GetResolver returns the resolver of the device, the go resolver reads /etc/resolv.conf
+// which does not exist on android, the dns servers of the active network are used instead
+func GetResolver() *net.Resolver {
+	if runtime.GOOS == "windows" || CheckFileIsExist("/etc/resolv.conf") {
+		return net.DefaultResolver
+	}
+	servers := resolver.getServers()
+	if len(servers) == 0 {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			var conn net.Conn
+			var err error
+			for _, server := range servers {
+				if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(server, "53")); err == nil {
+					return conn, nil
+				}
+			}
+			return nil, err
+		},
+	}
+}
@@ -7,10 +7,12 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shirou/gopsutil/process"
 
@@ -25,15 +27,19 @@ func NewAndroidShell() *AndroidShell {
 	return &AndroidShell{debugLog: DebugLogger}
 }
 
-func (t *AndroidShell) RunShell(command string) string {
+func getShellCmd() string {
 	//BUGFIX: Some mobile phone shells are not in/bin/sh, but in/system/bin/sh,
 	//so we simply use sh in the environment variable
 	//In order not to change the previous code logic, keep/bin/sh as the first choice,
 	//and use the sh command by default if it is not found
-	var shellCmd = "/bin/sh"
 	if !CheckFileIsExist("/bin/sh") {
-		shellCmd = "sh"
+		return "sh"
 	}
+	return "/bin/sh"
+}
+
+func (t *AndroidShell) RunShell(command string) string {
+	shellCmd := getShellCmd()
 	if t.debugLog != nil {
 		t.debugLog.Println("[CMD]", shellCmd, "-c", command)
 	}
@@ -46,6 +52,23 @@ func (t *AndroidShell) RunShell(command string) string {
 	return string(output)
 }
 
+// StartShell starts a long running command, the caller reads the stdout and kills the process when done,
+// the command is run with exec so that the process is not left behind the shell
+func (t *AndroidShell) StartShell(command string) (*exec.Cmd, io.ReadCloser, error) {
+	if t.debugLog != nil {
+		t.debugLog.Println("[CMD]", getShellCmd(), "-c", "exec "+command)
+	}
+	cmd := exec.Command(getShellCmd(), "-c", "exec "+command)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return cmd, stdout, nil
+}
+
 func (t *AndroidShell) GetSdkVersion() int64 {
 	output := t.RunShell("getprop ro.build.version.sdk")
 	output = strings.TrimSpace(output)
@@ -57,20 +80,71 @@ func (t *AndroidShell) GetSdkVersion() int64 {
 }
 
 func (t *AndroidShell) GetTopmostPackage(sdkVersion int64) string {
-	var output string
+	return strings.Split(t.GetTopmostActivity(sdkVersion), "/")[0]
+}
+
+// GetTopmostActivity returns the component name of the resumed activity, e.g. com.example/.MainActivity
+func (t *AndroidShell) GetTopmostActivity(sdkVersion int64) string {
 	if sdkVersion >= 33 {
-		output = t.RunShell("dumpsys activity activities |grep topResumedActivity")
-	} else {
-		output = t.RunShell("dumpsys activity activities |grep mResumedActivity")
+		return ParseTopmostActivity(t.RunShell("dumpsys activity activities |grep topResumedActivity"))
 	}
+	return ParseTopmostActivity(t.RunShell("dumpsys activity activities |grep mResumedActivity"))
+}
 
+// ParseTopmostActivity parses the component name of the first activity record, it returns empty if none is dumped
+func ParseTopmostActivity(output string) string {
 	r := regexp.MustCompile("ActivityRecord{(.*)}")
 	sz := r.FindStringSubmatch(output)
 	if len(sz) <= 1 {
 		return ""
 	}
-	activityName := strings.Split(sz[1], " ")[2]
-	return strings.Split(activityName, "/")[0]
+	fields := strings.Split(sz[1], " ")
+	if len(fields) <= 2 {
+		return ""
+	}
+	return fields[2]
+}
+
+// State of the screen
+const (
+	ScreenStateUnknown = iota //neither the power manager nor the display is dumped
+	ScreenStateOn
+	ScreenStateOff
+)
+
+// GetScreenState checks the power manager wakefulness (Awake, Asleep, Dozing, Dreaming),
+// falls back to the display screen state if the wakefulness is not available
+func (t *AndroidShell) GetScreenState() int {
+	if state := ParseWakefulness(t.RunShell("dumpsys power |grep mWakefulness=")); state != ScreenStateUnknown {
+		return state
+	}
+	return ParseDisplayScreenState(t.RunShell("dumpsys display |grep mScreenState="))
+}
+
+// ParseWakefulness parses the wakefulness of 'dumpsys power', the screen is on only if the device is awake
+func ParseWakefulness(output string) int {
+	r := regexp.MustCompile("mWakefulness=(\\w+)")
+	sz := r.FindStringSubmatch(output)
+	if len(sz) <= 1 {
+		return ScreenStateUnknown
+	}
+	if sz[1] == "Awake" {
+		return ScreenStateOn
+	}
+	return ScreenStateOff
+}
+
+// ParseDisplayScreenState parses the screen state of 'dumpsys display' (ON, OFF, DOZE, DOZE_SUSPEND...)
+func ParseDisplayScreenState(output string) int {
+	r := regexp.MustCompile("mScreenState=(\\w+)")
+	sz := r.FindStringSubmatch(output)
+	if len(sz) <= 1 || sz[1] == "UNKNOWN" {
+		return ScreenStateUnknown
+	}
+	if sz[1] == "ON" {
+		return ScreenStateOn
+	}
+	return ScreenStateOff
 }
 
 func (t *AndroidShell) GetPackagePath(pkgName string) string {
@@ -208,8 +282,8 @@ type PingStat struct {
 	RssLst       []float64
 }
 
-func (t *AndroidShell) GetPingStat(domainAddr string, packCount int) (*PingStat, error) {
-	output := t.RunShell(fmt.Sprintf("ping -c %d -i 0.2 -W 1000 %s", packCount, domainAddr))
+func (t *AndroidShell) GetPingStat(domainAddr string, packCount int, interval time.Duration) (*PingStat, error) {
+	output := t.RunShell(fmt.Sprintf("ping -c %d -i %s -W 1000 %s", packCount, strconv.FormatFloat(interval.Seconds(), 'f', -1, 64), domainAddr))
 	rRss := regexp.MustCompile("time=(.*) ms")
 	matchLst := rRss.FindAllStringSubmatch(output, -1)
 	retPingStat := &PingStat{
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+)
+
+// The outputs follow the lines printed by PowerManagerService, DisplayPowerController
+// and ActivityTaskManagerService, filtered by the same grep as the shell commands
+func TestParseScreenState(t *testing.T) {
+	cases := []struct {
+		name   string
+		parse  func(string) int
+		output string
+		expect int
+	}{
+		{"power awake", ParseWakefulness, "  mWakefulness=Awake\n", ScreenStateOn},
+		{"power asleep", ParseWakefulness, "  mWakefulness=Asleep\n", ScreenStateOff},
+		{"power dozing", ParseWakefulness, "  mWakefulness=Dozing\n", ScreenStateOff},
+		{"power dreaming", ParseWakefulness, "  mWakefulness=Dreaming\n", ScreenStateOff},
+		{"power not dumped", ParseWakefulness, "", ScreenStateUnknown},
+		{"power service missing", ParseWakefulness, "Can't find service: power\n", ScreenStateUnknown},
+		{"display on", ParseDisplayScreenState, "  mScreenState=ON\n", ScreenStateOn},
+		{"display off", ParseDisplayScreenState, "  mScreenState=OFF\n", ScreenStateOff},
+		{"display doze", ParseDisplayScreenState, "  mScreenState=DOZE_SUSPEND\n", ScreenStateOff},
+		{"display unknown", ParseDisplayScreenState, "  mScreenState=UNKNOWN\n", ScreenStateUnknown},
+		{"display not dumped", ParseDisplayScreenState, "/system/bin/sh: dumpsys: inaccessible or not found\n", ScreenStateUnknown},
+	}
+	for _, v := range cases {
+		if state := v.parse(v.output); state != v.expect {
+			t.Errorf("ERROR: %s state=%d, expect %d", v.name, state, v.expect)
+		}
+	}
+}
+
+func TestParseTopmostActivity(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		expect string
+	}{
+		{"android 13", "  topResumedActivity=ActivityRecord{4b1a9e2 u0 com.android.settings/.Settings t123}\n", "com.android.settings/.Settings"},
+		{"android 10", "    mResumedActivity: ActivityRecord{a1b2c3d u0 com.haima.cloudgame/.GameActivity t45}\n", "com.haima.cloudgame/.GameActivity"},
+		{"no resumed activity", "    mResumedActivity: null\n", ""},
+		{"not dumped", "", ""},
+	}
+	for _, v := range cases {
+		if activity := ParseTopmostActivity(v.output); activity != v.expect {
+			t.Errorf("ERROR: %s activity=%s, expect %s", v.name, activity, v.expect)
+		}
+	}
+}